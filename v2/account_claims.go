@@ -16,8 +16,15 @@
 package jwt
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nats-io/nkeys"
@@ -39,6 +46,39 @@ func (a *AccountLimits) IsUnlimited() bool {
 	return *a == AccountLimits{NoLimit, NoLimit, true, NoLimit, NoLimit}
 }
 
+// AccountUsage is the observed usage of an account, used to suggest limits.
+// Counts set to NoLimit are unknown.
+type AccountUsage struct {
+	Imports         int64
+	Exports         int64
+	WildcardExports bool // wildcard subjects are exported
+	Conn            int64
+	LeafNodeConn    int64
+}
+
+// SuggestLimits returns least privilege limits for the observed usage: every known count
+// is raised by the headroom (0.2 for 20%) and rounded up, unknown counts stay unlimited.
+// Wildcard exports are only allowed when they are in use.
+func SuggestLimits(usage AccountUsage, headroom float64) AccountLimits {
+	if headroom < 0 {
+		headroom = 0
+	}
+	suggest := func(n int64) int64 {
+		if n < 0 {
+			return NoLimit
+		}
+		// ignore floating point error, 100 with 10% headroom is 110 and not 111
+		return int64(math.Ceil(float64(n)*(1+headroom) - 1e-9))
+	}
+	return AccountLimits{
+		Imports:         suggest(usage.Imports),
+		Exports:         suggest(usage.Exports),
+		WildcardExports: usage.WildcardExports,
+		Conn:            suggest(usage.Conn),
+		LeafNodeConn:    suggest(usage.LeafNodeConn),
+	}
+}
+
 type NatsLimits struct {
 	Subs    int64 `json:"subs,omitempty"`    // Max number of subscriptions
 	Data    int64 `json:"data,omitempty"`    // Max number of bytes
@@ -50,6 +90,41 @@ func (n *NatsLimits) IsUnlimited() bool {
 	return *n == NatsLimits{NoLimit, NoLimit, NoLimit}
 }
 
+// Summary returns the limits formatted for display, byte counts use IEC units
+func (n NatsLimits) Summary() map[string]string {
+	return map[string]string{
+		"subs":    formatCount(n.Subs),
+		"data":    formatBytes(n.Data),
+		"payload": formatBytes(n.Payload),
+	}
+}
+
+func formatCount(v int64) string {
+	if v < 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func formatBytes(v int64) string {
+	if v < 0 {
+		return "unlimited"
+	}
+	const unit = 1024
+	if v < unit {
+		return fmt.Sprintf("%d B", v)
+	}
+	// pick the unit after rounding, so that 1048575 is 1 MiB rather than 1024 KiB
+	n, exp := float64(v)/unit, 0
+	for math.Round(n*100)/100 >= unit && exp < 5 {
+		n /= unit
+		exp++
+	}
+	f := strconv.FormatFloat(n, 'f', 2, 64)
+	f = strings.TrimRight(strings.TrimRight(f, "0"), ".")
+	return fmt.Sprintf("%s %ciB", f, "KMGTPE"[exp])
+}
+
 type JetStreamLimits struct {
 	MemoryStorage int64 `json:"mem_storage,omitempty"`  // Max number of bytes stored in memory across all streams. (0 means disabled)
 	DiskStorage   int64 `json:"disk_storage,omitempty"` // Max number of bytes stored on disk across all streams. (0 means disabled)
@@ -62,6 +137,21 @@ func (j *JetStreamLimits) IsUnlimited() bool {
 	return *j == JetStreamLimits{NoLimit, NoLimit, NoLimit, NoLimit}
 }
 
+// Validate flags contradictory JetStream limits. Since some combinations are
+// legitimate, issues are reported as warnings.
+func (j *JetStreamLimits) Validate(vr *ValidationResults) {
+	storage := j.MemoryStorage != 0 || j.DiskStorage != 0
+	if !storage && j.Streams != 0 {
+		vr.AddWarning("jetstream streams are allowed, but memory and disk storage are disabled")
+	}
+	if storage && j.Streams == 0 {
+		vr.AddWarning("jetstream storage is allowed, but streams are disabled")
+	}
+	if j.Streams == 0 && j.Consumer != 0 {
+		vr.AddWarning("jetstream consumers are allowed, but streams are disabled")
+	}
+}
+
 // OperatorLimits are used to limit access by an account
 type OperatorLimits struct {
 	NatsLimits
@@ -80,10 +170,57 @@ func (o *OperatorLimits) IsUnlimited() bool {
 }
 
 // Validate checks that the operator limits contain valid values
-func (o *OperatorLimits) Validate(_ *ValidationResults) {
+func (o *OperatorLimits) Validate(vr *ValidationResults) {
 	// negative values mean unlimited, so all numbers are valid
+	o.JetStreamLimits.Validate(vr)
+}
+
+// Authorization configures external authorization (auth callout) for the account. Users
+// connecting to the account are authorized by a service connected as one of the auth users.
+type Authorization struct {
+	// AuthUsers are the user public keys the auth service connects with
+	AuthUsers StringList `json:"auth_users,omitempty"`
+	// AuthAccount is the account the auth service is in, if not this account
+	AuthAccount string `json:"auth_account,omitempty"`
+	// XKey is the curve public key authorization requests are encrypted with
+	XKey string `json:"xkey,omitempty"`
+}
+
+// IsEmpty returns true if external authorization is not configured
+func (a *Authorization) IsEmpty() bool {
+	return len(a.AuthUsers) == 0 && a.AuthAccount == "" && a.XKey == ""
 }
 
+// Validate checks that the auth callout configuration references well formed keys
+func (a *Authorization) Validate(vr *ValidationResults) {
+	if a.IsEmpty() {
+		return
+	}
+	if len(a.AuthUsers) == 0 {
+		vr.AddError("external authorization requires at least one auth user")
+	}
+	for _, u := range a.AuthUsers {
+		if !nkeys.IsValidPublicUserKey(u) {
+			vr.AddError("auth user %q is not a user public key", u)
+		}
+	}
+	if a.AuthAccount != "" && !nkeys.IsValidPublicAccountKey(a.AuthAccount) {
+		vr.AddError("auth account %q is not an account public key", a.AuthAccount)
+	}
+	if a.XKey != "" && !isValidPublicCurveKey(a.XKey) {
+		vr.AddError("xkey %q is not a curve public key", a.XKey)
+	}
+}
+
+// isValidPublicCurveKey checks that the key is an encoded curve (x25519) public key
+func isValidPublicCurveKey(key string) bool {
+	// nkeys has no curve prefix to decode with, so check prefix and length explicitly
+	return len(key) == 56 && strings.HasPrefix(key, "X") && nkeys.IsValidEncoding([]byte(key))
+}
+
+// jsAPIPrefix covers all JetStream API subjects
+const jsAPIPrefix = Subject("$JS.API.>")
+
 // Account holds account specific claims data
 type Account struct {
 	Imports            Imports        `json:"imports,omitempty"`
@@ -92,6 +229,22 @@ type Account struct {
 	SigningKeys        SigningKeys    `json:"signing_keys,omitempty"`
 	Revocations        RevocationList `json:"revocations,omitempty"`
 	DefaultPermissions Permissions    `json:"default_permissions,omitempty"`
+	// SigningKeyRevocations revokes all JWTs issued by a signing key prior to the timestamp
+	SigningKeyRevocations RevocationList `json:"signing_key_revocations,omitempty"`
+	// Authorization configures an external authorization service (auth callout)
+	Authorization *Authorization `json:"authorization,omitempty"`
+	// AllowedConnectionTypes restricts the connection types of the account's users, empty allows all
+	AllowedConnectionTypes StringList `json:"allowed_connection_types,omitempty"`
+	// JetStreamAPI restricts the JetStream API subjects usable by the account, empty allows all
+	JetStreamAPI StringList `json:"jetstream_api,omitempty"`
+	// ImplicitDeny lists subjects denied to publish and subscribe for all users of the account
+	// in addition to $SYS.>. It is advisory: EffectiveUserPermissions applies it, the server
+	// doesn't enforce it.
+	ImplicitDeny StringList `json:"implicit_deny,omitempty"`
+	// AllowSystemSubjects opts out of the implicit $SYS.> deny, e.g. for the system account
+	AllowSystemSubjects bool `json:"allow_system_subjects,omitempty"`
+	// OperatorTags are governance labels set by the operator, see ValidateOperatorTags
+	OperatorTags TagList `json:"operator_tags,omitempty"`
 	Info
 	GenericFields
 }
@@ -102,9 +255,12 @@ func (a *Account) Validate(acct *AccountClaims, vr *ValidationResults) {
 	a.Exports.Validate(vr)
 	a.Limits.Validate(vr)
 	a.DefaultPermissions.Validate(vr)
-
-	if !a.Limits.IsEmpty() && a.Limits.Imports >= 0 && int64(len(a.Imports)) > a.Limits.Imports {
-		vr.AddError("the account contains more imports than allowed by the operator")
+	if a.DefaultPermissions.Resp != nil {
+		for _, e := range a.Exports {
+			if e != nil {
+				e.ValidateResponsePermission(a.DefaultPermissions.Resp, vr)
+			}
+		}
 	}
 
 	// Check Imports and Exports for limit violations.
@@ -126,10 +282,66 @@ func (a *Account) Validate(acct *AccountClaims, vr *ValidationResults) {
 			}
 		}
 	}
+	a.validateLimitsForExports(vr)
+	for _, i := range a.Imports {
+		if i == nil {
+			continue
+		}
+		local := i.localSubject()
+		for _, e := range a.Exports {
+			if e != nil && e.Type == i.Type && local.overlaps(e.Subject) {
+				vr.AddWarning("import %q into %q overlaps export %q of the account", i.Subject, local, e.Subject)
+			}
+		}
+	}
 	a.SigningKeys.Validate(vr)
+	for k := range a.SigningKeyRevocations {
+		if k != All && !nkeys.IsValidPublicAccountKey(k) {
+			vr.AddError("revoked signing key %q is not an account public key", k)
+		}
+	}
+	if a.Authorization != nil {
+		a.Authorization.Validate(vr)
+	}
+	for _, s := range a.ImplicitDeny {
+		Subject(s).Validate(vr)
+		if Subject(s).hasEmptyTokens() {
+			vr.AddError("implicit deny subject %q is malformed", s)
+		}
+	}
+	for _, s := range a.JetStreamAPI {
+		Subject(s).Validate(vr)
+		if !Subject(s).IsContainedIn(jsAPIPrefix) {
+			vr.AddError("jetstream api subject %q is not within %q", s, jsAPIPrefix)
+		}
+	}
+	for _, ct := range a.AllowedConnectionTypes {
+		if !isKnownConnectionType(ct) {
+			vr.AddWarning("unknown allowed connection type %q", ct)
+		}
+	}
 	a.Info.Validate(vr)
 }
 
+// validateLimitsForExports warns about limits that keep the exports of the account from
+// functioning, exceeding the import and export counts is reported by Validate
+func (a *Account) validateLimitsForExports(vr *ValidationResults) {
+	if len(a.Exports) == 0 {
+		return
+	}
+	if a.Limits.Conn == 0 {
+		vr.AddWarning("the account has exports but its limits allow no connections to serve them")
+	}
+	for _, e := range a.Exports {
+		if e != nil && e.IsService() && a.Limits.Subs == 0 {
+			vr.AddWarning("service export %q can't receive requests, the account limits allow no subscriptions", e.Subject)
+		}
+		if e != nil && a.Limits.Exports == NoLimit && !a.Limits.WildcardExports && e.Subject.HasWildCards() {
+			vr.AddWarning("wildcard export %q is not allowed by the account limits", e.Subject)
+		}
+	}
+}
+
 // AccountClaims defines the body of an account JWT
 type AccountClaims struct {
 	ClaimsData
@@ -153,6 +365,28 @@ func NewAccountClaims(subject string) *AccountClaims {
 	return c
 }
 
+// NewAccount bootstraps an account: it generates the account key pair, creates account
+// claims for it and signs them with the operator key pair. The returned key pair holds
+// the seed, callers are responsible for persisting it.
+func NewAccount(operator nkeys.KeyPair) (accountKP nkeys.KeyPair, claims *AccountClaims, token string, err error) {
+	if operator == nil {
+		return nil, nil, "", errors.New("operator key pair is required")
+	}
+	akp, err := nkeys.CreateAccount()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	pub, err := akp.PublicKey()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	ac := NewAccountClaims(pub)
+	if token, err = ac.Encode(operator); err != nil {
+		return nil, nil, "", err
+	}
+	return akp, ac, token, nil
+}
+
 // Encode converts account claims into a JWT string
 func (a *AccountClaims) Encode(pair nkeys.KeyPair) (string, error) {
 	if !nkeys.IsValidPublicAccountKey(a.Subject) {
@@ -164,6 +398,69 @@ func (a *AccountClaims) Encode(pair nkeys.KeyPair) (string, error) {
 	return a.ClaimsData.encode(pair, a)
 }
 
+// EncodeWithID converts account claims into a JWT string and also returns the
+// claim ID (jti) computed while encoding
+func (a *AccountClaims) EncodeWithID(pair nkeys.KeyPair) (string, string, error) {
+	token, err := a.Encode(pair)
+	if err != nil {
+		return "", "", err
+	}
+	return token, a.ID, nil
+}
+
+// EstimatedTokenSize returns the size of the JWT the claims encode to, without signing them.
+// The issuer, the ID and the signature are accounted for with their fixed sizes. If the
+// claims can't be serialized 0 is returned, Encode fails for those claims too.
+func (a *AccountClaims) EstimatedTokenSize() int {
+	h, err := serialize(&Header{TokenTypeJwt, AlgorithmNkey})
+	if err != nil {
+		return 0
+	}
+	c := *a
+	if c.Issuer == "" {
+		// public keys have 56 characters
+		c.Issuer = strings.Repeat("A", 56)
+	}
+	c.IssuedAt = Now().UTC().Unix()
+	// the ID is the base32 encoded sha-512/256 hash
+	c.ID = strings.Repeat("A", 52)
+	c.Type = AccountClaim
+	c.updateVersion()
+	j, err := json.Marshal(&c)
+	if err != nil {
+		return 0
+	}
+	if j, err = a.addUnknownFields(j); err != nil {
+		return 0
+	}
+	// ed25519 signatures have 64 bytes
+	return len(h) + 1 + base64.RawURLEncoding.EncodedLen(len(j)) + 1 + base64.RawURLEncoding.EncodedLen(64)
+}
+
+// EncodeValidated validates the account claims before encoding them. If validation
+// reports blocking issues the claims are not signed and an empty token is returned
+// along with the results. Warnings and time checks do not prevent encoding.
+func (a *AccountClaims) EncodeValidated(pair nkeys.KeyPair) (string, *ValidationResults, error) {
+	// validate a copy with the issuer the claims will be signed with, so that claims
+	// that are refused are left unchanged
+	c := *a
+	if pair != nil {
+		if pk, err := pair.PublicKey(); err == nil {
+			c.Issuer = pk
+		}
+	}
+	vr := CreateValidationResults()
+	c.Validate(vr)
+	if vr.IsBlocking(false) {
+		return "", vr, errors.New("account claims have blocking validation issues")
+	}
+	token, err := a.Encode(pair)
+	if err != nil {
+		return "", vr, err
+	}
+	return token, vr, nil
+}
+
 // DecodeAccountClaims decodes account claims from a JWT string
 func DecodeAccountClaims(token string) (*AccountClaims, error) {
 	claims, err := Decode(token)
@@ -172,7 +469,7 @@ func DecodeAccountClaims(token string) (*AccountClaims, error) {
 	}
 	ac, ok := claims.(*AccountClaims)
 	if !ok {
-		return nil, errors.New("not account claim")
+		return nil, newUnexpectedClaimTypeError(AccountClaim, claims)
 	}
 	return ac, nil
 }
@@ -186,11 +483,19 @@ func (a *AccountClaims) Payload() interface{} {
 	return &a.Account
 }
 
-// Validate checks the accounts contents
+// Validate checks the accounts contents. Accounts are signed by operators, self-signed
+// accounts are rejected unless ValidateWithOptions allows them.
 func (a *AccountClaims) Validate(vr *ValidationResults) {
-	a.ClaimsData.Validate(vr)
+	a.validate(vr, ValidateOptions{})
+}
+
+func (a *AccountClaims) validate(vr *ValidationResults, opts ValidateOptions) {
+	a.ClaimsData.validate(vr, opts.MaxExpiration)
 	a.Account.Validate(a, vr)
 
+	if a.Issuer != "" && a.Issuer == a.Subject && !opts.AllowSelfSigned {
+		vr.AddError("account is self-signed, accounts have to be signed by an operator")
+	}
 	if nkeys.IsValidPublicAccountKey(a.ClaimsData.Issuer) {
 		if !a.Limits.IsEmpty() {
 			vr.AddWarning("self-signed account JWTs shouldn't contain operator limits")
@@ -198,6 +503,335 @@ func (a *AccountClaims) Validate(vr *ValidationResults) {
 	}
 }
 
+// ValidateWithOptions validates the account claims like Validate, with the strictness
+// configured by the options. RequireHTTPSImports applies to the account's imports.
+func (a *AccountClaims) ValidateWithOptions(vr *ValidationResults, opts ValidateOptions) {
+	from := len(vr.Issues)
+	a.validate(vr, opts)
+	for _, i := range a.Imports {
+		if i == nil {
+			continue
+		}
+		if opts.RequireActivationTokens && i.Token == "" {
+			vr.AddError("import %q has no activation token", i.Subject)
+		}
+		u := i.tokenURL()
+		if u == nil {
+			continue
+		}
+		if opts.RequireHTTPSImports && u.Scheme != "https" {
+			vr.AddError("activation token of import %q is not retrieved with https", i.Subject)
+		}
+		if opts.WarnPrivateTokenHosts && isPrivateHost(u.Hostname()) {
+			vr.AddWarning("activation token of import %q is retrieved from %q, which is not a public host",
+				i.Subject, u.Hostname())
+		}
+	}
+	opts.applyTo(vr, from)
+}
+
+// ExpiringImports returns the imports with an embedded activation token that expires
+// within the duration from now, including already expired ones. Imports referencing
+// their token by URL are skipped.
+func (a *AccountClaims) ExpiringImports(within time.Duration, now time.Time) []*Import {
+	var expiring []*Import
+	deadline := now.Add(within).Unix()
+	for _, i := range a.Imports {
+		if i == nil || i.Token == "" || i.tokenURL() != nil {
+			continue
+		}
+		act, err := i.DecodeActivation()
+		if err != nil {
+			continue
+		}
+		if act.Expires != 0 && act.Expires <= deadline {
+			expiring = append(expiring, i)
+		}
+	}
+	return expiring
+}
+
+// ValidateImportsFrom checks the imports referencing the exporting account against the
+// exports it declares. Unlike Validate this requires the exporter's claims to be available.
+func (a *AccountClaims) ValidateImportsFrom(exporter *AccountClaims, vr *ValidationResults) {
+	if exporter == nil {
+		vr.AddError("exporting account is required")
+		return
+	}
+	for _, i := range a.Imports {
+		if i != nil && i.Account == exporter.Subject {
+			i.validateWithExporter(a, exporter, vr)
+		}
+	}
+}
+
+// ValidateOperatorTags checks the operator tags of the account against the tags the
+// operator set. The claims have to be issued by the operator or one of its signing keys,
+// and tags added or removed by the account are reported as errors.
+func (a *AccountClaims) ValidateOperatorTags(operator *OperatorClaims, expected TagList, vr *ValidationResults) {
+	if operator == nil {
+		vr.AddError("operator is required to validate operator tags")
+		return
+	}
+	if !operator.DidSign(a) {
+		vr.AddError("account %q was not issued by operator %q, operator tags can't be trusted", a.Subject, operator.Subject)
+	}
+	for _, t := range a.OperatorTags {
+		if !expected.Contains(t) {
+			vr.AddError("operator tag %q was not set by the operator", t)
+		}
+	}
+	for _, t := range expected {
+		if !a.OperatorTags.Contains(t) {
+			vr.AddError("operator tag %q set by the operator is missing", t)
+		}
+	}
+}
+
+// ValidateExportsFor warns about importing accounts that still import from an inactive
+// export of this account. Such imports no longer work until the export is reactivated.
+func (a *AccountClaims) ValidateExportsFor(importers []*AccountClaims, vr *ValidationResults) {
+	for _, importer := range importers {
+		if importer == nil {
+			continue
+		}
+		for _, i := range importer.Imports {
+			if i == nil || i.Account != a.Subject || a.Exports.MatchingExport(i) != nil {
+				continue
+			}
+			if e := a.Exports.matchingExport(i, true); e != nil {
+				vr.AddWarning("account %q still imports %q from inactive export %q", importer.Subject, i.Subject, e.Subject)
+			}
+		}
+	}
+}
+
+// EffectiveUserPermissions returns the permissions a user of the account ends up with.
+// Users without permissions get the account's default permissions. The account's
+// implicit deny subjects and $SYS.>, unless AllowSystemSubjects is set, are added to the
+// publish and subscribe deny lists. This is computed by the library only, the server
+// doesn't apply implicit denies.
+func (a *AccountClaims) EffectiveUserPermissions(u *UserClaims) Permissions {
+	p := a.DefaultPermissions
+	if u != nil && !reflect.DeepEqual(u.Permissions, Permissions{}) {
+		p = u.Permissions
+	}
+	var eff Permissions
+	eff.Pub.Allow.Add(p.Pub.Allow...)
+	eff.Pub.Deny.Add(p.Pub.Deny...)
+	eff.Sub.Allow.Add(p.Sub.Allow...)
+	eff.Sub.Deny.Add(p.Sub.Deny...)
+	if p.Resp != nil {
+		resp := *p.Resp
+		eff.Resp = &resp
+	}
+	var deny StringList
+	if !a.AllowSystemSubjects {
+		deny.Add(string(sysPrefix))
+	}
+	deny.Add(a.ImplicitDeny...)
+	eff.Pub.Deny.Add(deny...)
+	eff.Sub.Deny.Add(deny...)
+	return eff
+}
+
+// ValidateUserConnectionTypes warns about connection types the user allows that are
+// not allowed by the account, users can't connect with those.
+func (a *AccountClaims) ValidateUserConnectionTypes(u *UserClaims, vr *ValidationResults) {
+	if u == nil || len(a.AllowedConnectionTypes) == 0 {
+		return
+	}
+	for _, ct := range u.AllowedConnectionTypes {
+		allowed := false
+		for _, act := range a.AllowedConnectionTypes {
+			if strings.EqualFold(ct, act) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			vr.AddWarning("user %q allows connection type %q which account %q doesn't allow", u.Subject, ct, a.Subject)
+		}
+	}
+}
+
+// ValidateUserLimits warns about user limits exceeding the limits of the account, the
+// account limits apply regardless. Unlimited (NoLimit) user limits defer to the account.
+func (a *AccountClaims) ValidateUserLimits(u *UserClaims, vr *ValidationResults) {
+	if u == nil {
+		return
+	}
+	for _, l := range []struct {
+		name          string
+		user, account int64
+	}{
+		{"subscriptions", u.Limits.Subs, a.Limits.Subs},
+		{"data", u.Limits.Data, a.Limits.Data},
+		{"payload", u.Limits.Payload, a.Limits.Payload},
+	} {
+		if l.account != NoLimit && l.user != NoLimit && l.user > l.account {
+			vr.AddWarning("user %q %s limit %d exceeds the account limit %d", u.Subject, l.name, l.user, l.account)
+		}
+	}
+}
+
+// NatsData returns the raw nats section of the account claims. Fields decoded from
+// a token that this version of the library doesn't model are included.
+func (a *AccountClaims) NatsData() json.RawMessage {
+	d, err := a.ClaimsData.natsData(a)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+// DecodeNatsData unmarshals the raw nats section of the account claims into v
+func (a *AccountClaims) DecodeNatsData(v interface{}) error {
+	d, err := a.ClaimsData.natsData(a)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return errors.New("claims have no nats data")
+	}
+	return json.Unmarshal(d, v)
+}
+
+// HasExport returns true if the account has an export of the type whose subject
+// overlaps the subject, so an export of foo.* is found for foo.bar and vice versa.
+func (a *AccountClaims) HasExport(subject string, typ ExportType) bool {
+	for _, e := range a.Exports {
+		if e != nil && e.Type == typ && Subject(subject).overlaps(e.Subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasImport returns true if the account has an import of the type whose local subject
+// overlaps the subject. For stream imports with To the local subject is To.
+func (a *AccountClaims) HasImport(subject string, typ ImportType) bool {
+	for _, i := range a.Imports {
+		if i != nil && i.Type == typ && Subject(subject).overlaps(i.localSubject()) {
+			return true
+		}
+	}
+	return false
+}
+
+// UntrackedTokenExports returns the exports requiring an activation token that have
+// no revocations recorded. Without revocation bookkeeping access to them can't be audited.
+func (a *AccountClaims) UntrackedTokenExports() []*Export {
+	var untracked []*Export
+	for _, e := range a.Exports {
+		if e != nil && e.TokenReq && len(e.Revocations) == 0 {
+			untracked = append(untracked, e)
+		}
+	}
+	return untracked
+}
+
+// ImportedSubjects returns the local subjects made available by imports, the subjects
+// stream imports are delivered on (To if set) and the subjects services are requested on.
+// Both lists are sorted and keep wildcards.
+func (a *AccountClaims) ImportedSubjects() ([]string, []string) {
+	var streams, services StringList
+	for _, i := range a.Imports {
+		if i == nil {
+			continue
+		}
+		switch i.Type {
+		case Stream:
+			if i.To != "" {
+				streams.Add(string(i.To))
+			} else {
+				streams.Add(string(i.Subject))
+			}
+		case Service:
+			services.Add(string(i.Subject))
+		}
+	}
+	sort.Strings(streams)
+	sort.Strings(services)
+	return streams, services
+}
+
+// EqualConfig returns true if both account claims configure the same account. The
+// issue and expiration times, and the claim ID derived from them, are ignored, lists
+// are compared regardless of their order.
+func (a *AccountClaims) EqualConfig(other *AccountClaims) bool {
+	if a == nil || other == nil {
+		return a == other
+	}
+	na, err := a.normalizedConfig()
+	if err != nil {
+		return false
+	}
+	no, err := other.normalizedConfig()
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, no)
+}
+
+// normalizedConfig returns the generic JSON form of the claims without timestamps
+// and with all arrays sorted
+func (a *AccountClaims) normalizedConfig() (interface{}, error) {
+	c := *a
+	c.IssuedAt = 0
+	c.Expires = 0
+	c.ID = ""
+	j, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	if j, err = c.addUnknownFields(j); err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(j, &v); err != nil {
+		return nil, err
+	}
+	return sortArrays(v), nil
+}
+
+// sortArrays recursively orders the arrays of a generic JSON value by their serialization
+func sortArrays(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = sortArrays(e)
+		}
+	case []interface{}:
+		keys := make([]string, len(t))
+		for i, e := range t {
+			t[i] = sortArrays(e)
+			j, _ := json.Marshal(t[i])
+			keys[i] = string(j)
+		}
+		sort.Sort(byKey{t, keys})
+	}
+	return v
+}
+
+type byKey struct {
+	values []interface{}
+	keys   []string
+}
+
+func (b byKey) Len() int {
+	return len(b.values)
+}
+
+func (b byKey) Swap(i, j int) {
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+func (b byKey) Less(i, j int) bool {
+	return b.keys[i] < b.keys[j]
+}
+
 func (a *AccountClaims) ClaimType() ClaimType {
 	return a.Type
 }
@@ -216,6 +850,11 @@ func (a *AccountClaims) Claims() *ClaimsData {
 	return &a.ClaimsData
 }
 
+// SignedBy returns the public key of the operator or operator signing key that signed the account
+func (a *AccountClaims) SignedBy() string {
+	return a.SigningKey()
+}
+
 // DidSign checks the claims against the account's public key and its signing keys
 func (a *AccountClaims) DidSign(uc Claims) bool {
 	if uc != nil {
@@ -228,9 +867,9 @@ func (a *AccountClaims) DidSign(uc Claims) bool {
 	return false
 }
 
-// Revoke enters a revocation by public key using time.Now().
+// Revoke enters a revocation by public key using Now().
 func (a *AccountClaims) Revoke(pubKey string) {
-	a.RevokeAt(pubKey, time.Now())
+	a.RevokeAt(pubKey, Now())
 }
 
 // RevokeAt enters a revocation by public key and timestamp into this account
@@ -244,11 +883,40 @@ func (a *AccountClaims) RevokeAt(pubKey string, timestamp time.Time) {
 	a.Revocations.Revoke(pubKey, timestamp)
 }
 
+// RevokeAll revokes all jwt issued for each of the public keys prior to timestamp, like
+// calling RevokeAt for every key. Duplicate and empty keys are ignored, newer existing
+// revocations are kept. Revocations are serialized ordered by public key.
+func (a *AccountClaims) RevokeAll(pubKeys []string, timestamp time.Time) {
+	if a.Revocations == nil {
+		a.Revocations = RevocationList{}
+	}
+	for _, k := range pubKeys {
+		if k != "" {
+			a.Revocations.Revoke(k, timestamp)
+		}
+	}
+}
+
 // ClearRevocation removes any revocation for the public key
 func (a *AccountClaims) ClearRevocation(pubKey string) {
 	a.Revocations.ClearRevocation(pubKey)
 }
 
+// RevokeBySigningKey revokes all jwt issued by the signing key prior to timestamp.
+// JWT issued by other signing keys are not affected.
+// If there is already a revocation for this signing key that is newer, it is kept.
+func (a *AccountClaims) RevokeBySigningKey(signingKey string, timestamp time.Time) {
+	if a.SigningKeyRevocations == nil {
+		a.SigningKeyRevocations = RevocationList{}
+	}
+	a.SigningKeyRevocations.Revoke(signingKey, timestamp)
+}
+
+// ClearSigningKeyRevocation removes any revocation for the signing key
+func (a *AccountClaims) ClearSigningKeyRevocation(signingKey string) {
+	a.SigningKeyRevocations.ClearRevocation(signingKey)
+}
+
 // isRevoked checks if the public key is in the revoked list with a timestamp later than the one passed in.
 // Generally this method is called with the subject and issue time of the jwt to be tested.
 // DO NOT pass time.Now(), it will not produce a stable/expected response.
@@ -256,11 +924,13 @@ func (a *AccountClaims) isRevoked(pubKey string, claimIssuedAt time.Time) bool {
 	return a.Revocations.IsRevoked(pubKey, claimIssuedAt)
 }
 
-// IsClaimRevoked checks if the account revoked the claim passed in.
+// IsClaimRevoked checks if the account revoked the claim passed in, either
+// directly or by revoking the signing key that issued it.
 // Invalid claims (nil, no Subject or IssuedAt) will return true.
 func (a *AccountClaims) IsClaimRevoked(claim *UserClaims) bool {
 	if claim == nil || claim.IssuedAt == 0 || claim.Subject == "" {
 		return true
 	}
-	return a.isRevoked(claim.Subject, time.Unix(claim.IssuedAt, 0))
+	issuedAt := time.Unix(claim.IssuedAt, 0)
+	return a.isRevoked(claim.Subject, issuedAt) || a.SigningKeyRevocations.IsRevoked(claim.Issuer, issuedAt)
 }
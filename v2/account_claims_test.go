@@ -17,6 +17,8 @@ package jwt
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -253,7 +255,7 @@ func TestLimitValidationInAccount(t *testing.T) {
 
 	account.Issuer = apk
 	vr = CreateValidationResults()
-	account.Validate(vr)
+	account.ValidateWithOptions(vr, ValidateOptions{AllowSelfSigned: true})
 
 	if vr.IsEmpty() || vr.IsBlocking(true) {
 		t.Fatal("bad issuer for limits should have non-blocking validation results")
@@ -300,6 +302,45 @@ func TestWildcardExportLimit(t *testing.T) {
 	}
 }
 
+func TestImportExportCountLimit(t *testing.T) {
+	apk := publicKey(createAccountNKey(t), t)
+	ipk := publicKey(createAccountNKey(t), t)
+
+	account := NewAccountClaims(apk)
+	account.Imports.Add(&Import{Subject: "foo", Account: ipk, Type: Stream},
+		&Import{Subject: "bar", Account: ipk, Type: Stream})
+	account.Exports.Add(&Export{Subject: "baz", Type: Stream},
+		&Export{Subject: "qux", Type: Stream})
+
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatal("unlimited imports and exports should have no validation issues")
+	}
+
+	account.Limits.Imports = 1
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	if len(vr.Errors()) != 1 || !vr.IsBlocking(true) {
+		t.Fatalf("expected a single blocking error for too many imports, got %v", vr.Issues)
+	}
+
+	account.Limits.Imports = 2
+	account.Limits.Exports = 1
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	if len(vr.Errors()) != 1 || !vr.IsBlocking(true) {
+		t.Fatalf("expected a single blocking error for too many exports, got %v", vr.Issues)
+	}
+
+	account.Limits.Exports = 2
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatal("imports and exports within their limits should have no validation issues")
+	}
+}
+
 func TestJetstreamLimits(t *testing.T) {
 	akp := createAccountNKey(t)
 	apk := publicKey(akp, t)
@@ -576,4 +617,831 @@ func TestInvalidAccountInfo(t *testing.T) {
 	if !vr.IsBlocking(true) {
 		t.Errorf("invalid info needs to be blocking")
 	}
+
+	for _, u := range []string{"http://", "https://exa mple.com/doc", "http://[::1/doc"} {
+		a.InfoURL = u
+		vr = CreateValidationResults()
+		a.Validate(vr)
+		if !vr.IsBlocking(false) {
+			t.Errorf("malformed info url %q needs to be blocking", u)
+		}
+	}
+}
+
+func TestAccountEncodeWithID(t *testing.T) {
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	token, id, err := account.EncodeWithID(createOperatorNKey(t))
+	AssertNoError(err, t)
+	if id == "" {
+		t.Fatal("expected an id")
+	}
+	decoded, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	AssertEquals(id, decoded.ID, t)
+
+	if _, _, err := NewAccountClaims(publicKey(createUserNKey(t), t)).EncodeWithID(akp); err == nil {
+		t.Fatal("expected encoding error")
+	}
+}
+
+func TestJetStreamLimitsContradictions(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits JetStreamLimits
+		warn   bool
+	}{
+		{"unlimited", JetStreamLimits{NoLimit, NoLimit, NoLimit, NoLimit}, false},
+		{"disabled", JetStreamLimits{}, false},
+		{"disk only", JetStreamLimits{0, 1024, 1, 1}, false},
+		{"no storage but streams", JetStreamLimits{0, 0, NoLimit, 0}, true},
+		{"storage but no streams", JetStreamLimits{1024, 0, 0, 0}, true},
+		{"consumers but no streams", JetStreamLimits{0, 0, 0, 10}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vr := CreateValidationResults()
+			test.limits.Validate(vr)
+			AssertEquals(test.warn, !vr.IsEmpty(), t)
+			AssertFalse(vr.IsBlocking(true), t)
+		})
+	}
+}
+
+func TestNatsLimitsSummary(t *testing.T) {
+	s := NatsLimits{NoLimit, NoLimit, NoLimit}.Summary()
+	AssertEquals("unlimited", s["subs"], t)
+	AssertEquals("unlimited", s["data"], t)
+	AssertEquals("unlimited", s["payload"], t)
+
+	s = NatsLimits{Subs: 100, Data: 10 * 1024 * 1024, Payload: 512}.Summary()
+	AssertEquals("100", s["subs"], t)
+	AssertEquals("10 MiB", s["data"], t)
+	AssertEquals("512 B", s["payload"], t)
+
+	for v, expected := range map[int64]string{
+		0:                      "0 B",
+		1024:                   "1 KiB",
+		1536:                   "1.5 KiB",
+		3 * 1024 * 1024 * 1024: "3 GiB",
+		5 << 50:                "5 PiB",
+		1024*1024 - 1:          "1 MiB",
+		1024*1024*1024 - 1:     "1 GiB",
+		1023:                   "1023 B",
+	} {
+		AssertEquals(expected, formatBytes(v), t)
+	}
+}
+
+func TestUserRevocationBySigningKey(t *testing.T) {
+	akp := createAccountNKey(t)
+	sk1 := createAccountNKey(t)
+	sk2 := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.SigningKeys.Add(publicKey(sk1, t), publicKey(sk2, t))
+
+	newUser := func(kp nkeys.KeyPair) *UserClaims {
+		uc := NewUserClaims(publicKey(createUserNKey(t), t))
+		uc.IssuerAccount = account.Subject
+		uc, err := DecodeUserClaims(encode(uc, kp, t))
+		AssertNoError(err, t)
+		return uc
+	}
+	u1 := newUser(sk1)
+	u2 := newUser(sk2)
+	AssertFalse(account.IsClaimRevoked(u1), t)
+	AssertFalse(account.IsClaimRevoked(u2), t)
+
+	account.RevokeBySigningKey(publicKey(sk1, t), time.Now().Add(time.Minute))
+	AssertTrue(account.IsClaimRevoked(u1), t)
+	AssertFalse(account.IsClaimRevoked(u2), t)
+
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	decoded, err := DecodeAccountClaims(encode(account, akp, t))
+	AssertNoError(err, t)
+	AssertTrue(decoded.IsClaimRevoked(u1), t)
+	AssertFalse(decoded.IsClaimRevoked(u2), t)
+
+	account.ClearSigningKeyRevocation(publicKey(sk1, t))
+	AssertFalse(account.IsClaimRevoked(u1), t)
+
+	account.RevokeBySigningKey(publicKey(createUserNKey(t), t), time.Now())
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestAccountExpiringImports(t *testing.T) {
+	ikp := createAccountNKey(t)
+	ekp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(ikp, t))
+	now := time.Now()
+
+	addImport := func(subject Subject, expires time.Time) *Import {
+		act := NewActivationClaims(account.Subject)
+		act.ImportSubject = subject
+		act.ImportType = Stream
+		if !expires.IsZero() {
+			act.Expires = expires.Unix()
+		}
+		i := &Import{Subject: subject, Account: publicKey(ekp, t), Type: Stream, Token: encode(act, ekp, t)}
+		account.Imports.Add(i)
+		return i
+	}
+	soon := addImport("soon", now.Add(time.Hour))
+	expired := addImport("expired", now.Add(-time.Hour))
+	addImport("later", now.Add(30*24*time.Hour))
+	addImport("never", time.Time{})
+	account.Imports.Add(&Import{Subject: "no.token", Account: publicKey(ekp, t), Type: Stream})
+	account.Imports.Add(&Import{Subject: "url", Account: publicKey(ekp, t), Type: Stream, Token: "http://localhost:1/token"})
+
+	expiring := account.ExpiringImports(24*time.Hour, now)
+	AssertEquals(2, len(expiring), t)
+	AssertEquals(soon, expiring[0], t)
+	AssertEquals(expired, expiring[1], t)
+
+	AssertEquals(1, len(account.ExpiringImports(0, now)), t)
+}
+
+func TestAccountEncodeValidated(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	okp := createOperatorNKey(t)
+
+	account := NewAccountClaims(apk)
+	account.Limits.Imports = 0
+	account.Imports.Add(&Import{Subject: "foo", Account: publicKey(createAccountNKey(t), t), Type: Stream})
+	token, vr, err := account.EncodeValidated(okp)
+	if err == nil || token != "" {
+		t.Fatal("account with blocking validation issues should not be encoded")
+	}
+	if vr == nil || !vr.IsBlocking(false) {
+		t.Fatal("expected blocking validation results")
+	}
+	AssertEquals("", account.Issuer, t)
+	AssertEquals(int64(0), account.IssuedAt, t)
+
+	// accounts signed by an account key with limits only produce a warning
+	askp := createAccountNKey(t)
+	account.Limits.Imports = NoLimit
+	token, vr, err = account.EncodeValidated(askp)
+	if err != nil || token == "" {
+		t.Fatalf("account with warnings only should be encoded: %v", err)
+	}
+	if len(vr.Warnings()) == 0 || vr.IsBlocking(true) {
+		t.Fatalf("expected warnings only, got %v", vr.Issues)
+	}
+	ac, err := DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(publicKey(askp, t), ac.Issuer, t)
+
+	// self-signed accounts are rejected
+	if _, _, err := account.EncodeValidated(akp); err == nil {
+		t.Fatal("self-signed account should not be encoded")
+	}
+	AssertEquals(publicKey(askp, t), account.Issuer, t)
+}
+
+func TestAccountAuthorization(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	upk := publicKey(createUserNKey(t), t)
+	xkey := "XAAACAQDAQCQMBYIBEFAWDANBYHRAEISCMKBKFQXDAMRUGY4DUPB7QO7"
+
+	account := NewAccountClaims(apk)
+	account.Authorization = &Authorization{}
+	account.Authorization.AuthUsers.Add(upk)
+	account.Authorization.AuthAccount = publicKey(createAccountNKey(t), t)
+	account.Authorization.XKey = xkey
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("valid auth callout config should have no validation issues: %v", vr.Issues)
+	}
+
+	token, err := account.Encode(createOperatorNKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac, err := DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(xkey, ac.Authorization.XKey, t)
+	AssertTrue(ac.Authorization.AuthUsers.Contains(upk), t)
+
+	for _, bad := range []string{
+		xkey[:55] + "A",                            // bad checksum
+		"U" + xkey[1:],                             // not a curve prefix
+		publicKey(createUserNKey(t), t),            // user key
+		"XAAACAQDAQCQMBYIBEFAWDANBYHRAEISCMKBKFQX", // too short
+	} {
+		account.Authorization.XKey = bad
+		vr = CreateValidationResults()
+		account.Validate(vr)
+		if !vr.IsBlocking(false) {
+			t.Fatalf("malformed xkey %q should be a blocking error", bad)
+		}
+	}
+
+	account.Authorization.XKey = xkey
+	account.Authorization.AuthUsers = StringList{apk}
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("auth users have to be user keys")
+	}
+
+	account.Authorization.AuthUsers = nil
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("auth callout config without auth users should be a blocking error")
+	}
+}
+
+func TestAccountWithoutAuthorization(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	token := encode(account, createOperatorNKey(t), t)
+	payload, err := decodeString(strings.Split(token, ".")[1])
+	AssertNoError(err, t)
+	AssertFalse(strings.Contains(string(payload), "authorization"), t)
+
+	ac, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	AssertTrue(ac.Authorization == nil, t)
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestValidateUserConnectionTypes(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	user := NewUserClaims(publicKey(createUserNKey(t), t))
+	user.AllowedConnectionTypes.Add(ConnectionTypeStandard, ConnectionTypeWebsocket)
+
+	// no account restriction
+	vr := CreateValidationResults()
+	account.ValidateUserConnectionTypes(user, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	account.AllowedConnectionTypes.Add(ConnectionTypeStandard, ConnectionTypeMqtt)
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	vr = CreateValidationResults()
+	account.ValidateUserConnectionTypes(user, vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], ConnectionTypeWebsocket), t)
+	AssertTrue(!vr.IsBlocking(true), t)
+
+	account.AllowedConnectionTypes.Add("PIGEON")
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+}
+
+func TestAccountHasExportAndImport(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	ipk := publicKey(createAccountNKey(t), t)
+	account.Exports.Add(&Export{Subject: "foo.*", Type: Service}, &Export{Subject: "events.>", Type: Stream})
+	account.Imports.Add(&Import{Subject: "bar.baz", Account: ipk, Type: Stream})
+
+	AssertTrue(account.HasExport("foo.bar", Service), t)
+	AssertTrue(account.HasExport("foo.*", Service), t)
+	AssertTrue(account.HasExport("*.bar", Service), t)
+	AssertTrue(account.HasExport("events.a.b", Stream), t)
+	AssertTrue(account.HasExport(">", Stream), t)
+	AssertFalse(account.HasExport("foo.bar", Stream), t)
+	AssertFalse(account.HasExport("foo.bar.baz", Service), t)
+	AssertFalse(account.HasExport("foo", Service), t)
+	AssertFalse(account.HasExport("events", Stream), t)
+
+	AssertTrue(account.HasImport("bar.baz", Stream), t)
+	AssertTrue(account.HasImport("bar.*", Stream), t)
+	AssertFalse(account.HasImport("bar.baz", Service), t)
+	AssertFalse(account.HasImport("bar.qux", Stream), t)
+
+	// remapped stream imports are matched by their local subject
+	account.Imports.Add(&Import{Subject: "events.>", To: "imported.>", Account: ipk, Type: Stream})
+	AssertTrue(account.HasImport("imported.foo", Stream), t)
+	AssertFalse(account.HasImport("events.foo", Stream), t)
+}
+
+func TestPinnedClock(t *testing.T) {
+	pinned := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	Now = func() time.Time { return pinned }
+	defer func() { Now = time.Now }()
+
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Expires = pinned.Add(time.Hour).Unix()
+	account.NotBefore = pinned.Add(-time.Hour).Unix()
+	token, err := account.Encode(createOperatorNKey(t))
+	AssertNoError(err, t)
+	ac, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	AssertEquals(pinned.Unix(), ac.IssuedAt, t)
+
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	Now = func() time.Time { return pinned.Add(time.Hour + time.Second) }
+	vr = CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsBlocking(true) && !vr.IsBlocking(false), t)
+
+	Now = func() time.Time { return pinned.Add(-time.Hour - time.Second) }
+	vr = CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsBlocking(true) && !vr.IsBlocking(false), t)
+}
+
+func TestAccountImportedSubjects(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	ipk := publicKey(createAccountNKey(t), t)
+	account.Imports.Add(
+		&Import{Subject: "events.>", Account: ipk, Type: Stream},
+		&Import{Subject: "orders.*", To: "local.orders.*", Account: ipk, Type: Stream},
+		&Import{Subject: "req.a", To: "svc.a", Account: ipk, Type: Service},
+		&Import{Subject: "req.*", Account: ipk, Type: Service},
+		&Import{Subject: "req.*", Account: publicKey(createAccountNKey(t), t), Type: Service},
+	)
+	streams, services := account.ImportedSubjects()
+	AssertEquals("events.>,local.orders.*", strings.Join(streams, ","), t)
+	AssertEquals("req.*,req.a", strings.Join(services, ","), t)
+
+	streams, services = NewAccountClaims(publicKey(createAccountNKey(t), t)).ImportedSubjects()
+	AssertEquals(0, len(streams)+len(services), t)
+}
+
+func TestAccountJetStreamAPI(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.JetStreamAPI.Add("$JS.API.STREAM.CREATE.*", "$JS.API.STREAM.INFO.>", "$JS.API.INFO")
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("jetstream api subjects should be valid: %v", vr.Issues)
+	}
+
+	for _, s := range []string{"$JS.API", "$JS.EVENT.>", "foo.bar", ">"} {
+		account.JetStreamAPI = StringList{s}
+		vr = CreateValidationResults()
+		account.Validate(vr)
+		if !vr.IsBlocking(false) {
+			t.Fatalf("subject %q outside of the api prefix should be blocking", s)
+		}
+	}
+}
+
+func TestAccountEqualConfig(t *testing.T) {
+	okp := createOperatorNKey(t)
+	apk := publicKey(createAccountNKey(t), t)
+	ipk := publicKey(createAccountNKey(t), t)
+
+	a := NewAccountClaims(apk)
+	a.Imports.Add(&Import{Subject: "foo", Account: ipk, Type: Stream},
+		&Import{Subject: "bar", Account: ipk, Type: Stream})
+	a.Exports.Add(&Export{Subject: "baz", Type: Service})
+	a.SigningKeys.Add(publicKey(createAccountNKey(t), t), publicKey(createAccountNKey(t), t))
+	a.Expires = time.Now().Add(time.Hour).Unix()
+	ac, err := DecodeAccountClaims(encode(a, okp, t))
+	AssertNoError(err, t)
+
+	b := NewAccountClaims(apk)
+	b.Imports.Add(a.Imports[1], a.Imports[0])
+	b.Exports.Add(a.Exports...)
+	b.SigningKeys.Add(a.SigningKeys.Keys()...)
+	b.Expires = time.Now().Add(48 * time.Hour).Unix()
+	bc, err := DecodeAccountClaims(encode(b, okp, t))
+	AssertNoError(err, t)
+	bc.IssuedAt += 100
+	AssertTrue(ac.ID != bc.ID || ac.Expires != bc.Expires, t)
+
+	AssertTrue(ac.EqualConfig(bc), t)
+	AssertTrue(bc.EqualConfig(ac), t)
+
+	bc.Imports.Add(&Import{Subject: "qux", Account: ipk, Type: Stream})
+	AssertFalse(ac.EqualConfig(bc), t)
+	AssertFalse(ac.EqualConfig(nil), t)
+}
+
+func TestAccountRevokeAll(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, publicKey(createUserNKey(t), t))
+	}
+	now := time.Now()
+	later := now.Add(time.Hour)
+	account.RevokeAt(keys[0], later)
+
+	account.RevokeAll(append(keys, keys[1], ""), now)
+	AssertEquals(5, len(account.Revocations), t)
+	// the newer revocation is kept
+	AssertEquals(later.Unix(), account.Revocations[keys[0]], t)
+	for _, k := range keys[1:] {
+		AssertEquals(now.Unix(), account.Revocations[k], t)
+	}
+
+	single := NewAccountClaims(account.Subject)
+	single.RevokeAt(keys[0], later)
+	for _, k := range keys {
+		single.RevokeAt(k, now)
+	}
+	AssertTrue(reflect.DeepEqual(single.Revocations, account.Revocations), t)
+}
+
+func TestSelfSignedAccount(t *testing.T) {
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Limits = OperatorLimits{}
+	ac, err := DecodeAccountClaims(encode(account, akp, t))
+	AssertNoError(err, t)
+
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("self-signed account should be blocking")
+	}
+
+	vr = CreateValidationResults()
+	ac.ValidateWithOptions(vr, ValidateOptions{AllowSelfSigned: true})
+	AssertTrue(vr.IsEmpty(), t)
+
+	ac, err = DecodeAccountClaims(encode(account, createOperatorNKey(t), t))
+	AssertNoError(err, t)
+	vr = CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestAccountUntrackedTokenExports(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	tracked := &Export{Subject: "tracked", Type: Stream, TokenReq: true}
+	tracked.Revoke(publicKey(createAccountNKey(t), t))
+	untracked := &Export{Subject: "untracked", Type: Service, TokenReq: true}
+	public := &Export{Subject: "public", Type: Stream}
+	account.Exports.Add(tracked, untracked, public)
+
+	exports := account.UntrackedTokenExports()
+	AssertEquals(1, len(exports), t)
+	AssertEquals(untracked, exports[0], t)
+
+	untracked.Revoke(publicKey(createAccountNKey(t), t))
+	AssertEquals(0, len(account.UntrackedTokenExports()), t)
+}
+
+func TestAccountValidateWithOptions(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Exports.Add(&Export{Subject: ">", Type: Service})
+
+	// the defaults match Validate
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	vro := CreateValidationResults()
+	account.ValidateWithOptions(vro, ValidateOptions{})
+	AssertTrue(reflect.DeepEqual(vr, vro), t)
+	AssertEquals(1, len(vro.Warnings()), t)
+
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{TreatWarningsAsErrors: true})
+	AssertEquals(1, len(vr.Errors()), t)
+
+	account.Exports = nil
+	account.Expires = time.Now().Add(-time.Hour).Unix()
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{})
+	AssertTrue(vr.IsBlocking(true) && !vr.IsBlocking(false), t)
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{EnforceTime: true})
+	AssertTrue(vr.IsBlocking(false), t)
+	// time checks are not warnings
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{TreatWarningsAsErrors: true})
+	AssertFalse(vr.IsBlocking(false), t)
+
+	account.Expires = 0
+	account.Imports.Add(&Import{Subject: "foo", Account: publicKey(createAccountNKey(t), t),
+		Token: "http://127.0.0.1:1/token", Type: Stream})
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{})
+	AssertFalse(vr.IsBlocking(false), t)
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{RequireHTTPSImports: true})
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "https"), t)
+}
+
+func TestAccountImplicitDeny(t *testing.T) {
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	AssertTrue(account.ImplicitDeny == nil, t)
+	account.DefaultPermissions.Sub.Allow.Add("default.>")
+
+	user := NewUserClaims(publicKey(createUserNKey(t), t))
+	user.Pub.Allow.Add("foo.>")
+	user.Pub.Deny.Add("foo.bar")
+	eff := account.EffectiveUserPermissions(user)
+	AssertEquals("foo.>", strings.Join(eff.Pub.Allow, ","), t)
+	AssertEquals("foo.bar,$SYS.>", strings.Join(eff.Pub.Deny, ","), t)
+	AssertEquals("$SYS.>", strings.Join(eff.Sub.Deny, ","), t)
+	AssertFalse(permits(eff.Sub, "$SYS.REQ.SERVER.PING"), t)
+	// the user is not modified
+	AssertEquals(1, len(user.Pub.Deny), t)
+
+	// users without permissions get the defaults
+	eff = account.EffectiveUserPermissions(NewUserClaims(publicKey(createUserNKey(t), t)))
+	AssertEquals("default.>", strings.Join(eff.Sub.Allow, ","), t)
+	AssertEquals("$SYS.>", strings.Join(eff.Pub.Deny, ","), t)
+
+	// the default is not stored in the account jwt
+	token := encode(account, createOperatorNKey(t), t)
+	payload, err := decodeString(strings.Split(token, ".")[1])
+	AssertNoError(err, t)
+	AssertFalse(strings.Contains(string(payload), "implicit_deny"), t)
+
+	// a set list adds to the default and survives encoding
+	account.ImplicitDeny.Add("_INBOX.>")
+	ac, err := DecodeAccountClaims(encode(account, createOperatorNKey(t), t))
+	AssertNoError(err, t)
+	AssertEquals("_INBOX.>", strings.Join(ac.ImplicitDeny, ","), t)
+	eff = ac.EffectiveUserPermissions(user)
+	AssertEquals("foo.bar,$SYS.>,_INBOX.>", strings.Join(eff.Pub.Deny, ","), t)
+
+	// the system account opts out of the default
+	sys := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	sys.AllowSystemSubjects = true
+	sys, err = DecodeAccountClaims(encode(sys, createOperatorNKey(t), t))
+	AssertNoError(err, t)
+	eff = sys.EffectiveUserPermissions(user)
+	AssertEquals("foo.bar", strings.Join(eff.Pub.Deny, ","), t)
+	AssertTrue(permits(eff.Sub, "$SYS.REQ.SERVER.PING"), t)
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	ac.ImplicitDeny.Add("bad..subject", "with space")
+	vr = CreateValidationResults()
+	ac.Validate(vr)
+	AssertEquals(2, len(vr.Errors()), t)
+}
+
+func TestAccountOperatorTags(t *testing.T) {
+	okp := createOperatorNKey(t)
+	akp := createAccountNKey(t)
+	op := NewOperatorClaims(publicKey(okp, t))
+
+	var expected TagList
+	expected.Add("cost-center:42", "env:prod")
+
+	account := NewAccountClaims(publicKey(akp, t))
+	account.OperatorTags.Add(expected...)
+	ac, err := DecodeAccountClaims(encode(account, okp, t))
+	AssertNoError(err, t)
+
+	vr := CreateValidationResults()
+	ac.ValidateOperatorTags(op, expected, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// the account re-signed itself with changed tags
+	account.OperatorTags.Remove("env:prod")
+	account.OperatorTags.Add("env:dev")
+	ac, err = DecodeAccountClaims(encode(account, akp, t))
+	AssertNoError(err, t)
+
+	vr = CreateValidationResults()
+	ac.ValidateOperatorTags(op, expected, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+	AssertEquals(3, len(vr.Errors()), t)
+
+	vr = CreateValidationResults()
+	ac.ValidateOperatorTags(nil, expected, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestNewAccount(t *testing.T) {
+	okp := createOperatorNKey(t)
+	akp, claims, token, err := NewAccount(okp)
+	AssertNoError(err, t)
+
+	pub := publicKey(akp, t)
+	AssertEquals(pub, claims.Subject, t)
+	AssertEquals(publicKey(okp, t), claims.Issuer, t)
+	seed, err := akp.Seed()
+	AssertNoError(err, t)
+	AssertTrue(len(seed) > 0, t)
+
+	ac, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	AssertEquals(pub, ac.Subject, t)
+	AssertEquals(publicKey(okp, t), ac.Issuer, t)
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	if _, _, _, err := NewAccount(nil); err == nil {
+		t.Fatal("expected an error without operator key pair")
+	}
+	if _, _, _, err := NewAccount(createUserNKey(t)); err == nil {
+		t.Fatal("expected an error for a user key pair")
+	}
+}
+
+func TestImportToCollidesWithExport(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Exports.Add(&Export{Subject: "foo.bar", Type: Stream})
+	account.Imports.Add(&Import{Subject: "orders", To: "foo.bar", Account: publicKey(createAccountNKey(t), t), Type: Stream})
+
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	AssertFalse(vr.IsBlocking(true), t)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], "foo.bar"), t)
+
+	account.Imports[0].To = "foo.*"
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+
+	account.Imports[0].To = "baz"
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestLimitsPreventingExports(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Exports.Add(&Export{Subject: "svc", Type: Service}, &Export{Subject: "events.>", Type: Stream})
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	account.Limits.Exports = 1
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "more exports"), t)
+
+	account.Limits.Exports = NoLimit
+	account.Limits.Conn = 0
+	account.Limits.Subs = 0
+	account.Limits.WildcardExports = false
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertFalse(vr.IsBlocking(true), t)
+	AssertEquals(3, len(vr.Warnings()), t)
+}
+
+func TestAccountEstimatedTokenSize(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	estimate := account.EstimatedTokenSize()
+	token := encode(account, okp, t)
+	AssertEquals(len(token), estimate, t)
+
+	for i := 0; i < 50; i++ {
+		account.Exports.Add(&Export{Subject: Subject(fmt.Sprintf("svc.%d", i)), Type: Service})
+	}
+	account.Description = strings.Repeat("x", 1000)
+	estimate = account.EstimatedTokenSize()
+	token = encode(account, okp, t)
+	// the issued at time can differ in length by a few characters
+	if diff := len(token) - estimate; diff < -8 || diff > 8 {
+		t.Fatalf("estimate %d differs from actual size %d", estimate, len(token))
+	}
+}
+
+func TestSuggestLimits(t *testing.T) {
+	usage := AccountUsage{Imports: 10, Exports: 3, Conn: 42, LeafNodeConn: NoLimit}
+	limits := SuggestLimits(usage, 0.2)
+	AssertEquals(AccountLimits{Imports: 12, Exports: 4, WildcardExports: false, Conn: 51, LeafNodeConn: NoLimit}, limits, t)
+
+	// unused counts stay at zero, wildcards are kept when used
+	limits = SuggestLimits(AccountUsage{Imports: 0, Exports: 5, WildcardExports: true, Conn: NoLimit, LeafNodeConn: 1}, 0.2)
+	AssertEquals(AccountLimits{Imports: 0, Exports: 6, WildcardExports: true, Conn: NoLimit, LeafNodeConn: 2}, limits, t)
+
+	AssertEquals(int64(110), SuggestLimits(AccountUsage{Conn: 100}, 0.1).Conn, t)
+
+	limits = SuggestLimits(AccountUsage{Imports: 7, Exports: 7, Conn: 7, LeafNodeConn: 7}, -1)
+	AssertEquals(int64(7), limits.Conn, t)
+}
+
+func TestValidatePrivateTokenHosts(t *testing.T) {
+	akp := createAccountNKey(t)
+	ekp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	activation := NewActivationClaims(account.Subject)
+	activation.ImportSubject = "foo"
+	activation.ImportType = Stream
+	token := encode(activation, ekp, t)
+
+	// serve the activation from the cache, so validation doesn't fetch it
+	cache := NewActivationCache(time.Hour)
+	SetActivationCache(cache)
+	defer SetActivationCache(nil)
+
+	i := &Import{Subject: "foo", Account: publicKey(ekp, t), Type: Stream}
+	account.Imports.Add(i)
+	opts := ValidateOptions{WarnPrivateTokenHosts: true}
+	check := func(u string, warnings int) {
+		t.Helper()
+		cache.Set(u, token, 0)
+		i.Token = u
+		vr := CreateValidationResults()
+		account.ValidateWithOptions(vr, opts)
+		if len(vr.Warnings()) != warnings {
+			t.Fatalf("expected %d warnings for %q: %v", warnings, u, vr.Warnings())
+		}
+		vr = CreateValidationResults()
+		account.ValidateWithOptions(vr, ValidateOptions{})
+		AssertTrue(vr.IsEmpty(), t)
+	}
+
+	for _, u := range []string{"https://127.0.0.1:8080/activation", "http://localhost/a", "https://10.1.2.3/a",
+		"https://192.168.0.10/a", "https://172.20.0.1/a", "https://[::1]/a", "https://169.254.1.1/a", "https://[fd00::1]/a"} {
+		check(u, 1)
+	}
+	for _, u := range []string{"https://activations.example.com/a", "https://8.8.8.8/a", "https://172.32.0.1/a"} {
+		check(u, 0)
+	}
+}
+
+func TestAccountSignedByIssuer(t *testing.T) {
+	okp := createOperatorNKey(t)
+	skp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+
+	ac, err := DecodeAccountClaims(encode(account, skp, t))
+	AssertNoError(err, t)
+	AssertEquals(publicKey(skp, t), ac.SignedBy(), t)
+	AssertEquals(ac.Issuer, ac.SigningKey(), t)
+
+	ac, err = DecodeAccountClaims(encode(account, okp, t))
+	AssertNoError(err, t)
+	AssertEquals(publicKey(okp, t), ac.SignedBy(), t)
+}
+
+func TestRequireActivationTokens(t *testing.T) {
+	akp := createAccountNKey(t)
+	ekp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Imports.Add(&Import{Subject: "open", Account: publicKey(ekp, t), Type: Stream})
+
+	vr := CreateValidationResults()
+	account.ValidateWithOptions(vr, ValidateOptions{})
+	AssertTrue(vr.IsEmpty(), t)
+
+	opts := ValidateOptions{RequireActivationTokens: true}
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, opts)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "open"), t)
+
+	activation := NewActivationClaims(account.Subject)
+	activation.ImportSubject = "open"
+	activation.ImportType = Stream
+	account.Imports[0].Token = encode(activation, ekp, t)
+	vr = CreateValidationResults()
+	account.ValidateWithOptions(vr, opts)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestValidateUserLimits(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	user := NewUserClaims(publicKey(createUserNKey(t), t))
+	user.Limits.Payload = 1024 * 1024
+
+	vr := CreateValidationResults()
+	account.ValidateUserLimits(user, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	account.Limits.Payload = 1024
+	vr = CreateValidationResults()
+	account.ValidateUserLimits(user, vr)
+	AssertFalse(vr.IsBlocking(true), t)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], "payload"), t)
+
+	// unlimited users defer to the account
+	user.Limits.Payload = NoLimit
+	account.Limits.Subs = 10
+	vr = CreateValidationResults()
+	account.ValidateUserLimits(user, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	user.Limits.Payload = 1024
+	user.Limits.Subs = 11
+	vr = CreateValidationResults()
+	account.ValidateUserLimits(user, vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], "subscriptions"), t)
 }
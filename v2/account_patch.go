@@ -0,0 +1,250 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchablePaths are the account paths a patch may modify
+var patchablePaths = []string{"/nats/imports", "/nats/exports", "/nats/limits", "/nats/tags"}
+
+// patchableLists are the lists of the nats section that are omitted when empty, they
+// are added to the patched document so that elements can be appended to them
+var patchableLists = []string{"imports", "exports", "tags"}
+
+// limitsPath can't be removed and limits added or replaced there are merged onto the
+// current limits, limits missing from the document would decode as 0 rather than NoLimit
+const limitsPath = "/nats/limits"
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func isPatchablePath(p string) bool {
+	for _, pp := range patchablePaths {
+		if p == pp || strings.HasPrefix(p, pp+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyPatch applies a RFC 6902 JSON Patch to the account. Only the add, remove,
+// replace and test operations are supported, and only for paths below imports,
+// exports, limits and tags. Patches touching anything else, such as the subject or
+// issuer, are rejected, as is removing limits - replace them instead. A replaced limits
+// object is merged onto the current limits, so limits it doesn't name are kept. If any operation
+// fails or the patched account has blocking validation issues the claim is left unchanged.
+func (a *AccountClaims) ApplyPatch(patch []byte) error {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return fmt.Errorf("invalid patch: %v", err)
+	}
+	for _, op := range ops {
+		if !isPatchablePath(op.Path) {
+			return fmt.Errorf("patching %q is not allowed", op.Path)
+		}
+		if op.Op == "remove" && (op.Path == limitsPath || strings.HasPrefix(op.Path, limitsPath+"/")) {
+			return fmt.Errorf("removing %q is not allowed, replace the limits instead", op.Path)
+		}
+	}
+	d, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(d, &doc); err != nil {
+		return err
+	}
+	if nats, ok := doc.(map[string]interface{})["nats"].(map[string]interface{}); ok {
+		for _, l := range patchableLists {
+			if _, ok := nats[l]; !ok {
+				nats[l] = []interface{}{}
+			}
+		}
+	}
+	for _, op := range ops {
+		if op.Path == limitsPath && (op.Op == "add" || op.Op == "replace") {
+			if op.Value, err = mergeLimits(doc, op.Value); err != nil {
+				return err
+			}
+		}
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return err
+		}
+	}
+	nats, err := json.Marshal(doc.(map[string]interface{})["nats"])
+	if err != nil {
+		return err
+	}
+	acc := Account{SigningKeys: make(SigningKeys)}
+	if err := json.Unmarshal(nats, &acc); err != nil {
+		return fmt.Errorf("patched account is invalid: %v", err)
+	}
+	patched := *a
+	patched.Account = acc
+	vr := CreateValidationResults()
+	patched.Validate(vr)
+	if vr.IsBlocking(false) {
+		return fmt.Errorf("patched account has blocking validation issues: %v", vr.Errors())
+	}
+	a.Account = acc
+	return nil
+}
+
+// mergeLimits returns the limits of the document with the limits of value applied
+func mergeLimits(doc interface{}, value json.RawMessage) (json.RawMessage, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	var limits map[string]interface{}
+	if err := json.Unmarshal(value, &limits); err != nil {
+		return nil, fmt.Errorf("invalid value for %q: %v", limitsPath, err)
+	}
+	merged := make(map[string]interface{})
+	if current, err := getPatchValue(doc, parsePointer(limitsPath)); err == nil {
+		if m, ok := current.(map[string]interface{}); ok {
+			for k, v := range m {
+				merged[k] = v
+			}
+		}
+	}
+	for k, v := range limits {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+// parsePointer splits a RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(p string) []string {
+	tokens := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, tk := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(tk, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens
+}
+
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	tokens := parsePointer(op.Path)
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%s operation on %q requires a value", op.Op, op.Path)
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %v", op.Path, err)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unsupported patch operation %q", op.Op)
+	}
+	if op.Op == "test" {
+		v, err := getPatchValue(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, value) {
+			return nil, fmt.Errorf("test of %q failed", op.Path)
+		}
+		return doc, nil
+	}
+	return patchValue(doc, tokens, op.Op, value)
+}
+
+func getPatchValue(node interface{}, tokens []string) (interface{}, error) {
+	for _, tk := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[tk]
+			if !ok {
+				return nil, fmt.Errorf("path element %q not found", tk)
+			}
+			node = v
+		case []interface{}:
+			idx, err := strconv.Atoi(tk)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return nil, fmt.Errorf("invalid array index %q", tk)
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("path element %q not found", tk)
+		}
+	}
+	return node, nil
+}
+
+// patchValue applies the operation at the path described by tokens and returns the
+// modified node, which may be a new slice if an array was modified
+func patchValue(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	tk := tokens[0]
+	last := len(tokens) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tk]
+		if !ok && (!last || op != "add") {
+			return nil, fmt.Errorf("path element %q not found", tk)
+		}
+		if !last {
+			c, err := patchValue(child, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[tk] = c
+		} else if op == "remove" {
+			delete(n, tk)
+		} else {
+			n[tk] = value
+		}
+		return n, nil
+	case []interface{}:
+		if last && op == "add" && tk == "-" {
+			return append(n, value), nil
+		}
+		idx, err := strconv.Atoi(tk)
+		if err != nil || idx < 0 || idx > len(n) || (idx == len(n) && (!last || op != "add")) {
+			return nil, fmt.Errorf("invalid array index %q", tk)
+		}
+		if !last {
+			c, err := patchValue(n[idx], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[idx] = c
+			return n, nil
+		}
+		switch op {
+		case "add":
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+		case "replace":
+			n[idx] = value
+		case "remove":
+			n = append(n[:idx], n[idx+1:]...)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path element %q not found", tk)
+	}
+}
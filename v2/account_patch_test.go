@@ -0,0 +1,146 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccountApplyPatch(t *testing.T) {
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Exports.Add(&Export{Subject: "foo", Type: Stream})
+
+	err := account.ApplyPatch([]byte(`[
+		{"op": "test", "path": "/nats/limits/conn", "value": -1},
+		{"op": "replace", "path": "/nats/limits/conn", "value": 10},
+		{"op": "add", "path": "/nats/exports/-", "value": {"subject": "bar", "type": "service"}},
+		{"op": "add", "path": "/nats/tags", "value": ["prod"]}
+	]`))
+	AssertNoError(err, t)
+	AssertEquals(int64(10), account.Limits.Conn, t)
+	AssertEquals(int64(NoLimit), account.Limits.Subs, t)
+	AssertEquals(2, len(account.Exports), t)
+	AssertEquals(Subject("bar"), account.Exports[1].Subject, t)
+	AssertTrue(account.Exports[1].IsService(), t)
+	AssertTrue(account.Tags.Contains("prod"), t)
+
+	AssertNoError(account.ApplyPatch([]byte(`[{"op": "remove", "path": "/nats/exports/0"}]`)), t)
+	AssertEquals(1, len(account.Exports), t)
+	AssertEquals(Subject("bar"), account.Exports[0].Subject, t)
+
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestAccountApplyPatchRejected(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	account := NewAccountClaims(apk)
+
+	for _, p := range []string{
+		`[{"op": "replace", "path": "/sub", "value": "ABC"}]`,
+		`[{"op": "replace", "path": "/iss", "value": "ABC"}]`,
+		`[{"op": "add", "path": "/nats/signing_keys", "value": ["ABC"]}]`,
+		`[{"op": "replace", "path": "/nats/limitsx", "value": {}}]`,
+		`[{"op": "move", "from": "/nats/limits", "path": "/nats/tags"}]`,
+		`[{"op": "replace", "path": "/nats/limits/conn"}]`,
+		`[{"op": "remove", "path": "/nats/imports/0"}]`,
+		`not a patch`,
+	} {
+		if err := account.ApplyPatch([]byte(p)); err == nil {
+			t.Fatalf("expected patch to be rejected: %s", p)
+		}
+	}
+	AssertEquals(apk, account.Subject, t)
+
+	// failing operations don't leave partial modifications behind
+	err := account.ApplyPatch([]byte(`[
+		{"op": "replace", "path": "/nats/limits/conn", "value": 5},
+		{"op": "test", "path": "/nats/limits/subs", "value": 999}
+	]`))
+	if err == nil {
+		t.Fatal("expected test operation to fail")
+	}
+	AssertEquals(int64(NoLimit), account.Limits.Conn, t)
+
+	err = account.ApplyPatch([]byte(`[{"op": "replace", "path": "/nats/limits/conn", "value": "ten"}]`))
+	if err == nil {
+		t.Fatal("expected type mismatch to fail")
+	}
+	AssertEquals(int64(NoLimit), account.Limits.Conn, t)
+}
+
+func TestAccountApplyPatchEmptyLists(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := publicKey(createAccountNKey(t), t)
+
+	err := account.ApplyPatch([]byte(`[
+		{"op": "add", "path": "/nats/imports/-", "value": {"subject": "foo", "account": "` + exporter + `", "type": "stream"}},
+		{"op": "add", "path": "/nats/exports/-", "value": {"subject": "bar", "type": "service"}},
+		{"op": "add", "path": "/nats/tags/-", "value": "prod"}
+	]`))
+	AssertNoError(err, t)
+	AssertEquals(1, len(account.Imports), t)
+	AssertEquals(Subject("foo"), account.Imports[0].Subject, t)
+	AssertEquals(1, len(account.Exports), t)
+	AssertTrue(account.Tags.Contains("prod"), t)
+}
+
+func TestAccountApplyPatchKeepsLimits(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	for _, p := range []string{
+		`[{"op": "remove", "path": "/nats/limits"}]`,
+		`[{"op": "remove", "path": "/nats/limits/subs"}]`,
+	} {
+		if err := account.ApplyPatch([]byte(p)); err == nil {
+			t.Fatalf("expected removing limits to be rejected: %s", p)
+		}
+	}
+	AssertEquals(int64(NoLimit), account.Limits.Conn, t)
+	AssertEquals(int64(NoLimit), account.Limits.Subs, t)
+}
+
+func TestAccountApplyPatchPartialLimits(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Limits.Conn = 5
+	for _, op := range []string{"replace", "add"} {
+		err := account.ApplyPatch([]byte(`[{"op": "` + op + `", "path": "/nats/limits", "value": {"subs": 10}}]`))
+		AssertNoError(err, t)
+		AssertEquals(int64(10), account.Limits.Subs, t)
+		AssertEquals(int64(5), account.Limits.Conn, t)
+		AssertEquals(int64(NoLimit), account.Limits.LeafNodeConn, t)
+		AssertEquals(int64(NoLimit), account.Limits.Imports, t)
+		AssertEquals(int64(NoLimit), account.Limits.Data, t)
+		AssertEquals(int64(NoLimit), account.Limits.DiskStorage, t)
+		AssertTrue(account.Limits.WildcardExports, t)
+	}
+	if err := account.ApplyPatch([]byte(`[{"op": "replace", "path": "/nats/limits", "value": 10}]`)); err == nil {
+		t.Fatal("expected limits that aren't an object to be rejected")
+	}
+}
+
+func TestAccountApplyPatchBlockingIssues(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	err := account.ApplyPatch([]byte(`[{"op": "add", "path": "/nats/exports/-", "value": {"subject": "foo bar", "type": "stream"}}]`))
+	if err == nil {
+		t.Fatal("expected the invalid export to be rejected")
+	}
+	AssertTrue(strings.Contains(err.Error(), "blocking"), t)
+	AssertEquals(0, len(account.Exports), t)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ActivationCache stores activation tokens retrieved from import token URLs
+type ActivationCache interface {
+	// Get returns the cached token for the URL
+	Get(url string) (string, bool)
+	// Set stores the token for the URL, a ttl of 0 selects the cache's default
+	Set(url string, token string, ttl time.Duration)
+}
+
+var (
+	activationCacheLock sync.RWMutex
+	activationCache     ActivationCache
+)
+
+// SetActivationCache sets the cache used when retrieving activation tokens from
+// URLs during import validation. A nil cache, the default, disables caching.
+func SetActivationCache(c ActivationCache) {
+	activationCacheLock.Lock()
+	defer activationCacheLock.Unlock()
+	activationCache = c
+}
+
+func getActivationCache() ActivationCache {
+	activationCacheLock.RLock()
+	defer activationCacheLock.RUnlock()
+	return activationCache
+}
+
+// cacheTTL returns the ttl requested by the response's Cache-Control header,
+// 0 if none was requested, and false if the response must not be cached.
+func cacheTTL(h http.Header) (time.Duration, bool) {
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store" || d == "no-cache":
+			return 0, false
+		case strings.HasPrefix(d, "max-age="):
+			s, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+			if err != nil || s <= 0 {
+				return 0, false
+			}
+			return time.Duration(s) * time.Second, true
+		}
+	}
+	return 0, true
+}
+
+type activationCacheEntry struct {
+	token   string
+	expires time.Time
+}
+
+type memActivationCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]activationCacheEntry
+}
+
+// NewActivationCache returns an in memory ActivationCache that keeps tokens for
+// ttl, unless the server responding with the token requests a different one.
+func NewActivationCache(ttl time.Duration) ActivationCache {
+	return &memActivationCache{ttl: ttl, entries: make(map[string]activationCacheEntry)}
+}
+
+func (c *memActivationCache) Get(url string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[url]
+	if !ok {
+		return "", false
+	}
+	if !Now().Before(e.expires) {
+		delete(c.entries, url)
+		return "", false
+	}
+	return e.token, true
+}
+
+func (c *memActivationCache) Set(url string, token string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.entries[url] = activationCacheEntry{token: token, expires: Now().Add(ttl)}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActivationCache(t *testing.T) {
+	ak := createAccountNKey(t)
+	ak2 := createAccountNKey(t)
+	akp := publicKey(ak, t)
+	i := &Import{Subject: "test", Account: publicKey(ak2, t), To: "bar", Type: Stream}
+
+	activation := NewActivationClaims(akp)
+	activation.ImportSubject = "test"
+	activation.ImportType = Stream
+	actJWT := encode(activation, ak2, t)
+
+	var hits int32
+	var cacheControl atomic.Value
+	cacheControl.Store("")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if cc := cacheControl.Load().(string); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		w.Write([]byte(actJWT))
+	}))
+	defer ts.Close()
+	i.Token = ts.URL
+
+	validate := func() {
+		vr := CreateValidationResults()
+		i.Validate(akp, vr)
+		if !vr.IsEmpty() {
+			t.Fatalf("import should be valid: %v", vr.Warnings())
+		}
+	}
+
+	// no cache by default
+	validate()
+	validate()
+	AssertEquals(int32(2), atomic.LoadInt32(&hits), t)
+
+	SetActivationCache(NewActivationCache(time.Minute))
+	defer SetActivationCache(nil)
+	validate()
+	validate()
+	AssertEquals(int32(3), atomic.LoadInt32(&hits), t)
+
+	// servers can opt out of caching
+	SetActivationCache(NewActivationCache(time.Minute))
+	cacheControl.Store("no-store")
+	validate()
+	validate()
+	AssertEquals(int32(5), atomic.LoadInt32(&hits), t)
+
+	cacheControl.Store("public, max-age=60")
+	validate()
+	validate()
+	AssertEquals(int32(6), atomic.LoadInt32(&hits), t)
+}
+
+func TestActivationCacheExpiry(t *testing.T) {
+	c := NewActivationCache(time.Minute)
+	c.Set("u", "token", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.Get("u"); ok {
+		t.Fatal("entry should have expired")
+	}
+	c.Set("u", "token", 0)
+	token, ok := c.Get("u")
+	AssertTrue(ok, t)
+	AssertEquals("token", token, t)
+
+	h := http.Header{}
+	ttl, ok := cacheTTL(h)
+	AssertTrue(ok, t)
+	AssertEquals(time.Duration(0), ttl, t)
+	h.Set("Cache-Control", "max-age=30")
+	ttl, ok = cacheTTL(h)
+	AssertTrue(ok, t)
+	AssertEquals(30*time.Second, ttl, t)
+	h.Set("Cache-Control", "no-cache")
+	_, ok = cacheTTL(h)
+	AssertFalse(ok, t)
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/nats-io/nkeys"
 )
@@ -87,7 +88,7 @@ func DecodeActivationClaims(token string) (*ActivationClaims, error) {
 	}
 	ac, ok := claims.(*ActivationClaims)
 	if !ok {
-		return nil, errors.New("not activation claim")
+		return nil, newUnexpectedClaimTypeError(ActivationClaim, claims)
 	}
 	return ac, nil
 }
@@ -102,10 +103,22 @@ func (a *ActivationClaims) Validate(vr *ValidationResults) {
 	a.validateWithTimeChecks(vr, true)
 }
 
+// ValidateWithOptions validates the activation claims like Validate, with the strictness
+// configured by the options
+func (a *ActivationClaims) ValidateWithOptions(vr *ValidationResults, opts ValidateOptions) {
+	from := len(vr.Issues)
+	a.validate(vr, true, opts.MaxExpiration)
+	opts.applyTo(vr, from)
+}
+
 // Validate checks the claims
 func (a *ActivationClaims) validateWithTimeChecks(vr *ValidationResults, timeChecks bool) {
+	a.validate(vr, timeChecks, 0)
+}
+
+func (a *ActivationClaims) validate(vr *ValidationResults, timeChecks bool, maxExpiration time.Duration) {
 	if timeChecks {
-		a.ClaimsData.Validate(vr)
+		a.ClaimsData.validate(vr, maxExpiration)
 	}
 	a.Activation.Validate(vr)
 	if a.IssuerAccount != "" && !nkeys.IsValidPublicAccountKey(a.IssuerAccount) {
@@ -393,7 +393,8 @@ func TestActivationClaimRevocation(t *testing.T) {
 
 	vr := ValidationResults{}
 	account.Validate(&vr)
-	if !vr.IsEmpty() {
+	// the only issue is the warning about the missing account token position
+	if vr.IsBlocking(true) || len(vr.Warnings()) != 1 {
 		t.Fatal("account validation shouldn't have failed")
 	}
 }
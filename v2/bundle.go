@@ -0,0 +1,160 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/nats-io/nkeys"
+)
+
+// PublicBundle holds the operator JWT and the account JWTs it trusts. It carries
+// no seeds and can be distributed freely.
+type PublicBundle struct {
+	Operator string   `json:"operator"`
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+// seedCandidate matches strings shaped like seeds of any key type
+var seedCandidate = regexp.MustCompile(`S[A-Z][A-Z2-7]{56}`)
+
+// BuildPublicBundle returns a JSON bundle of the operator and account JWTs.
+// Every token has to decode as the expected claim type.
+func BuildPublicBundle(operator string, accounts []string) ([]byte, error) {
+	b := &PublicBundle{Operator: operator, Accounts: accounts}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// ParsePublicBundle parses a bundle created by BuildPublicBundle. Bundles that
+// contain a seed, or tokens that don't decode, are rejected.
+func ParsePublicBundle(data []byte) (*PublicBundle, error) {
+	if containsSeed(data) {
+		return nil, errors.New("public bundle contains a seed")
+	}
+	var b PublicBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// check verifies that the bundle has no seeds and its tokens decode
+func (b *PublicBundle) check() error {
+	if b.Operator == "" {
+		return errors.New("public bundle requires an operator jwt")
+	}
+	if containsSeed([]byte(b.Operator)) {
+		return errors.New("public bundle contains a seed")
+	}
+	if _, err := DecodeOperatorClaims(b.Operator); err != nil {
+		return fmt.Errorf("invalid operator jwt: %v", err)
+	}
+	for idx, a := range b.Accounts {
+		if containsSeed([]byte(a)) {
+			return errors.New("public bundle contains a seed")
+		}
+		if _, err := DecodeAccountClaims(a); err != nil {
+			return fmt.Errorf("invalid account jwt at index %d: %v", idx, err)
+		}
+	}
+	return nil
+}
+
+func containsSeed(data []byte) bool {
+	for _, c := range seedCandidate.FindAll(data, -1) {
+		if _, _, err := nkeys.DecodeSeed(c); err == nil {
+			return true
+		}
+		// seeds of key types nkeys can't decode, such as curve keys, still have a
+		// valid checksum and the seed prefix
+		if nkeys.IsValidEncoding(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleClaimType is the type of the generic claims wrapping a signed bundle
+const bundleClaimType = "bundle"
+
+// EncodeBundle signs every claim with the signer and wraps the resulting JWTs in a
+// signed container, so the set can be deployed as a whole. Each JWT in the bundle
+// remains individually valid, the outer signature protects the set as a group.
+func EncodeBundle(claims []Claims, signer nkeys.KeyPair) (string, error) {
+	if signer == nil {
+		return "", errors.New("bundle signer is required")
+	}
+	pub, err := signer.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	tokens := make([]string, 0, len(claims))
+	for idx, c := range claims {
+		if c == nil {
+			return "", fmt.Errorf("claim at index %d is nil", idx)
+		}
+		token, err := c.Encode(signer)
+		if err != nil {
+			return "", fmt.Errorf("error encoding claim at index %d: %v", idx, err)
+		}
+		tokens = append(tokens, token)
+	}
+	gc := NewGenericClaims(pub)
+	gc.Data["type"] = bundleClaimType
+	gc.Data["jwts"] = tokens
+	return gc.Encode(signer)
+}
+
+// DecodeBundle verifies a bundle created by EncodeBundle and decodes the JWTs it contains.
+// A bundle that was modified fails the verification of its signature.
+func DecodeBundle(token string) ([]Claims, error) {
+	gc, err := DecodeGeneric(token)
+	if err != nil {
+		return nil, err
+	}
+	if gc.Data["type"] != bundleClaimType {
+		return nil, errors.New("not a bundle")
+	}
+	tokens, ok := gc.Data["jwts"].([]interface{})
+	if !ok {
+		return nil, errors.New("bundle contains no jwts")
+	}
+	claims := make([]Claims, 0, len(tokens))
+	for idx, t := range tokens {
+		s, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("bundle entry at index %d is not a jwt", idx)
+		}
+		c, err := Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt at index %d: %v", idx, err)
+		}
+		if c.Claims().Issuer != gc.Issuer {
+			return nil, fmt.Errorf("jwt at index %d was not issued by the bundle signer", idx)
+		}
+		claims = append(claims, c)
+	}
+	return claims, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+func TestPublicBundleRoundTrip(t *testing.T) {
+	okp := createOperatorNKey(t)
+	operator := encode(NewOperatorClaims(publicKey(okp, t)), okp, t)
+	a1 := encode(NewAccountClaims(publicKey(createAccountNKey(t), t)), okp, t)
+	a2 := encode(NewAccountClaims(publicKey(createAccountNKey(t), t)), okp, t)
+
+	data, err := BuildPublicBundle(operator, []string{a1, a2})
+	AssertNoError(err, t)
+	b, err := ParsePublicBundle(data)
+	AssertNoError(err, t)
+	AssertEquals(operator, b.Operator, t)
+	AssertEquals(2, len(b.Accounts), t)
+	AssertEquals(a1, b.Accounts[0], t)
+	AssertEquals(a2, b.Accounts[1], t)
+
+	// tokens have to be of the expected type
+	if _, err := BuildPublicBundle(a1, nil); err == nil {
+		t.Fatal("account jwt should not be accepted as operator")
+	}
+	if _, err := BuildPublicBundle(operator, []string{operator}); err == nil {
+		t.Fatal("operator jwt should not be accepted as account")
+	}
+}
+
+func TestPublicBundleRejectsSeed(t *testing.T) {
+	okp := createOperatorNKey(t)
+	operator := encode(NewOperatorClaims(publicKey(okp, t)), okp, t)
+	seed, err := createAccountNKey(t).Seed()
+	AssertNoError(err, t)
+
+	if _, err := BuildPublicBundle(operator, []string{string(seed)}); err == nil {
+		t.Fatal("bundle with a seed should not be built")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"operator": operator,
+		"seed":     string(seed),
+	})
+	AssertNoError(err, t)
+	if _, err := ParsePublicBundle(data); err == nil {
+		t.Fatal("bundle with a seed should be rejected")
+	}
+
+	server, err := nkeys.CreateServer()
+	AssertNoError(err, t)
+	cluster, err := nkeys.CreateCluster()
+	AssertNoError(err, t)
+	var seeds []string
+	for _, kp := range []nkeys.KeyPair{server, cluster} {
+		s, err := kp.Seed()
+		AssertNoError(err, t)
+		seeds = append(seeds, string(s))
+	}
+	// curve seed
+	seeds = append(seeds, "SXAACAQDAQCQMBYIBEFAWDANBYHRAEISCMKBKFQXDAMRUGY4DUPB6IC6WE")
+	for _, s := range seeds {
+		data, err := json.Marshal(map[string]interface{}{"operator": operator, "seed": s})
+		AssertNoError(err, t)
+		if _, err := ParsePublicBundle(data); err == nil {
+			t.Fatalf("bundle with seed %s should be rejected", s[:2])
+		}
+	}
+}
+
+func TestSignedBundleRoundTrip(t *testing.T) {
+	okp := createOperatorNKey(t)
+	op := NewOperatorClaims(publicKey(okp, t))
+	a1 := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	a1.Name = "A"
+	a2 := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	a2.Name = "B"
+
+	bundle, err := EncodeBundle([]Claims{op, a1, a2}, okp)
+	AssertNoError(err, t)
+
+	claims, err := DecodeBundle(bundle)
+	AssertNoError(err, t)
+	AssertEquals(3, len(claims), t)
+	AssertEquals(op.Subject, claims[0].(*OperatorClaims).Subject, t)
+	AssertEquals("A", claims[1].(*AccountClaims).Name, t)
+	AssertEquals("B", claims[2].(*AccountClaims).Name, t)
+
+	// the contained jwts are valid on their own
+	gc, err := DecodeGeneric(bundle)
+	AssertNoError(err, t)
+	for _, tk := range gc.Data["jwts"].([]interface{}) {
+		_, err := Decode(tk.(string))
+		AssertNoError(err, t)
+	}
+
+	if _, err := EncodeBundle([]Claims{a1}, nil); err == nil {
+		t.Fatal("expected an error without signer")
+	}
+	if _, err := DecodeBundle(encode(a1, okp, t)); err == nil {
+		t.Fatal("account jwt is not a bundle")
+	}
+}
+
+func TestSignedBundleTampered(t *testing.T) {
+	okp := createOperatorNKey(t)
+	a1 := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	a2 := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	bundle, err := EncodeBundle([]Claims{a1, a2}, okp)
+	AssertNoError(err, t)
+
+	// drop one of the jwts, keeping the original signature
+	chunks := strings.Split(bundle, ".")
+	payload, err := decodeString(chunks[1])
+	AssertNoError(err, t)
+	var m map[string]interface{}
+	AssertNoError(json.Unmarshal(payload, &m), t)
+	nats := m["nats"].(map[string]interface{})
+	nats["jwts"] = nats["jwts"].([]interface{})[:1]
+	payload, err = json.Marshal(m)
+	AssertNoError(err, t)
+	chunks[1] = encodeToString(payload)
+
+	if _, err := DecodeBundle(strings.Join(chunks, ".")); err == nil {
+		t.Fatal("tampered bundle should fail verification")
+	}
+}
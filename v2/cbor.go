@@ -0,0 +1,291 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// MarshalCBOR returns the claim content in CBOR (RFC 7049) instead of JSON. The
+// encoding carries the same data as the JSON payload of the token, it is meant for
+// transport and storage and is not signed.
+func (a *AccountClaims) MarshalCBOR() ([]byte, error) {
+	j, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if j, err = a.addUnknownFields(j); err != nil {
+		return nil, err
+	}
+	return jsonToCBOR(j)
+}
+
+// UnmarshalCBOR replaces the claim content with the CBOR encoded claims
+func (a *AccountClaims) UnmarshalCBOR(data []byte) error {
+	j, err := cborToJSON(data)
+	if err != nil {
+		return err
+	}
+	ac, err := loadAccount(j, libVersion)
+	if err != nil {
+		return err
+	}
+	if err := ac.setUnknownFields(j, ac); err != nil {
+		return err
+	}
+	*a = *ac
+	return nil
+}
+
+// CBOR major types
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborSimple = 7 << 5
+)
+
+const (
+	cborFalse   = cborSimple | 20
+	cborTrue    = cborSimple | 21
+	cborNull    = cborSimple | 22
+	cborFloat64 = cborSimple | 27
+)
+
+// cborMaxDepth bounds the nesting of decoded arrays and maps
+const cborMaxDepth = 64
+
+func jsonToCBOR(j []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(cborNull)
+	case bool:
+		if t {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			if i >= 0 {
+				writeCBORHead(buf, cborUint, uint64(i))
+			} else {
+				writeCBORHead(buf, cborNegInt, uint64(-(i + 1)))
+			}
+		} else if u, err := strconv.ParseUint(string(t), 10, 64); err == nil {
+			writeCBORHead(buf, cborUint, u)
+		} else {
+			f, err := t.Float64()
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(cborFloat64)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(t)))
+		buf.WriteString(t)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(t)))
+		for _, e := range t {
+			if err := writeCBOR(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeCBORHead(buf, cborMap, uint64(len(t)))
+		for _, k := range keys {
+			writeCBORHead(buf, cborText, uint64(len(k)))
+			buf.WriteString(k)
+			if err := writeCBOR(buf, t[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported cbor value %T", v)
+	}
+	return nil
+}
+
+func cborToJSON(data []byte) ([]byte, error) {
+	r := &cborReader{data: data}
+	v, err := r.read(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.data) {
+		return nil, errors.New("trailing data after cbor value")
+	}
+	return json.Marshal(v)
+}
+
+type cborReader struct {
+	data []byte
+	pos  int
+}
+
+var errCBORTruncated = errors.New("truncated cbor data")
+
+func (r *cborReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, errCBORTruncated
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// head returns the major type and argument of the next data item
+func (r *cborReader) head() (byte, uint64, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		arg, err := r.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		var n uint64
+		for _, c := range arg {
+			n = n<<8 | uint64(c)
+		}
+		return major, n, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported cbor additional info %d", info)
+}
+
+func (r *cborReader) read(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("cbor data nested too deeply")
+	}
+	start := r.pos
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor negative integer out of range")
+		}
+		return -int64(n) - 1, nil
+	case cborText:
+		b, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborArray:
+		// every element takes at least one byte
+		if n > uint64(len(r.data)-r.pos) {
+			return nil, errCBORTruncated
+		}
+		a := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			e, err := r.read(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		return a, nil
+	case cborMap:
+		if n > uint64(len(r.data)-r.pos) {
+			return nil, errCBORTruncated
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := r.read(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.New("cbor map keys have to be strings")
+			}
+			if m[ks], err = r.read(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborSimple:
+		switch r.data[start] {
+		case cborFalse:
+			return false, nil
+		case cborTrue:
+			return true, nil
+		case cborNull:
+			return nil, nil
+		case cborFloat64:
+			return math.Float64frombits(n), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported cbor data item 0x%x", r.data[start])
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jwt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAccountCBORRoundTrip(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Name = "cbor"
+	account.Expires = time.Now().Add(time.Hour).Unix()
+	account.Imports.Add(&Import{Subject: "foo", Account: publicKey(createAccountNKey(t), t), Type: Stream})
+	account.Exports.Add(&Export{Subject: "svc.*", Type: Service, TokenReq: true, AccountTokenPosition: 2,
+		ResponseThreshold: time.Second, Latency: &ServiceLatency{Sampling: 50, Results: "lat"}})
+	account.SigningKeys.Add(publicKey(createAccountNKey(t), t))
+	account.Limits.Data = 1 << 40
+	account.Tags.Add("one", "two")
+	// decoded claims carry everything the token does
+	ac, err := DecodeAccountClaims(encode(account, okp, t))
+	AssertNoError(err, t)
+
+	data, err := ac.MarshalCBOR()
+	AssertNoError(err, t)
+	j, err := json.Marshal(ac)
+	AssertNoError(err, t)
+	AssertTrue(len(data) < len(j), t)
+
+	var decoded AccountClaims
+	AssertNoError(decoded.UnmarshalCBOR(data), t)
+	dj, err := json.Marshal(&decoded)
+	AssertNoError(err, t)
+
+	var want, got interface{}
+	AssertNoError(json.Unmarshal(j, &want), t)
+	AssertNoError(json.Unmarshal(dj, &got), t)
+	AssertTrue(sortedJSON(t, want) == sortedJSON(t, got), t)
+	AssertEquals(int64(NoLimit), decoded.Limits.Conn, t)
+	AssertEquals(SamplingRate(50), decoded.Exports[0].Latency.Sampling, t)
+	AssertTrue(ac.EqualConfig(&decoded), t)
+}
+
+func TestInvalidCBOR(t *testing.T) {
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	data, err := account.MarshalCBOR()
+	AssertNoError(err, t)
+
+	var decoded AccountClaims
+	for _, bad := range [][]byte{nil, data[:len(data)-1], append(data, 0), {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		if err := decoded.UnmarshalCBOR(bad); err == nil {
+			t.Fatalf("expected an error decoding %x", bad)
+		}
+	}
+}
+
+func sortedJSON(t *testing.T, v interface{}) string {
+	j, err := json.Marshal(sortArrays(v))
+	AssertNoError(err, t)
+	return string(j)
+}
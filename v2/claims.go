@@ -27,6 +27,14 @@ import (
 	"github.com/nats-io/nkeys"
 )
 
+// Now returns the current time used when issuing claims and checking expiration
+// and not before constraints. Tests can replace it to pin the time.
+var Now = time.Now
+
+// defaultMaxExpiration is how far in the future a claim can expire before validation
+// warns about it, unless ValidateOptions configures a different bound
+const defaultMaxExpiration = 10 * 365 * 24 * time.Hour
+
 // ClaimType is used to indicate the type of JWT being stored in a Claim
 type ClaimType string
 
@@ -60,6 +68,21 @@ func IsGenericClaimType(s string) bool {
 	}
 }
 
+// UnexpectedClaimTypeError is returned by the typed decode functions
+// when the token holds a different kind of claim
+type UnexpectedClaimTypeError struct {
+	Expected ClaimType
+	Actual   ClaimType
+}
+
+func newUnexpectedClaimTypeError(expected ClaimType, c Claims) *UnexpectedClaimTypeError {
+	return &UnexpectedClaimTypeError{Expected: expected, Actual: c.ClaimType()}
+}
+
+func (e *UnexpectedClaimTypeError) Error() string {
+	return fmt.Sprintf("not %s claim - token holds %q claim", e.Expected, e.Actual)
+}
+
 // Claims is a JWT claims
 type Claims interface {
 	Claims() *ClaimsData
@@ -90,6 +113,9 @@ type ClaimsData struct {
 	Name      string `json:"name,omitempty"`
 	NotBefore int64  `json:"nbf,omitempty"`
 	Subject   string `json:"sub,omitempty"`
+	// unknown holds decoded fields this version of the library doesn't model,
+	// they are emitted again on encode so that tokens round-trip losslessly
+	unknown map[string]json.RawMessage
 }
 
 // Prefix holds the prefix byte for an NKey
@@ -173,7 +199,7 @@ func (c *ClaimsData) doEncode(header *Header, kp nkeys.KeyPair, claim Claims) (s
 	}
 
 	c.Issuer = issuerBytes
-	c.IssuedAt = time.Now().UTC().Unix()
+	c.IssuedAt = Now().UTC().Unix()
 	c.ID = "" // to create a repeatable hash
 	c.ID, err = c.hash()
 	if err != nil {
@@ -182,10 +208,15 @@ func (c *ClaimsData) doEncode(header *Header, kp nkeys.KeyPair, claim Claims) (s
 
 	claim.updateVersion()
 
-	payload, err := serialize(claim)
+	j, err := json.Marshal(claim)
+	if err != nil {
+		return "", err
+	}
+	j, err = c.addUnknownFields(j)
 	if err != nil {
 		return "", err
 	}
+	payload := encodeToString(j)
 
 	toSign := fmt.Sprintf("%s.%s", h, payload)
 	eSig := ""
@@ -204,6 +235,99 @@ func (c *ClaimsData) doEncode(header *Header, kp nkeys.KeyPair, claim Claims) (s
 	return fmt.Sprintf("%s.%s", toSign, eSig), nil
 }
 
+// setUnknownFields stores the fields of the raw claim data (top level or inside
+// the nats section) that are not present once the decoded claim is serialized.
+func (c *ClaimsData) setUnknownFields(data []byte, claim Claims) error {
+	var raw, known map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	j, err := json.Marshal(claim)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(j, &known); err != nil {
+		return err
+	}
+	unknown := make(map[string]json.RawMessage)
+	for k, v := range raw {
+		if _, ok := known[k]; !ok {
+			unknown[k] = v
+		}
+	}
+	var rawNats, knownNats map[string]json.RawMessage
+	if json.Unmarshal(raw["nats"], &rawNats) == nil && json.Unmarshal(known["nats"], &knownNats) == nil {
+		nats := make(map[string]json.RawMessage)
+		for k, v := range rawNats {
+			if _, ok := knownNats[k]; !ok {
+				nats[k] = v
+			}
+		}
+		if len(nats) > 0 {
+			if unknown["nats"], err = json.Marshal(nats); err != nil {
+				return err
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		c.unknown = unknown
+	}
+	return nil
+}
+
+// addUnknownFields merges previously decoded unknown fields into the serialized claim.
+// Fields modeled by the library take precedence.
+func (c *ClaimsData) addUnknownFields(j []byte) ([]byte, error) {
+	if len(c.unknown) == 0 {
+		return j, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(j, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range c.unknown {
+		if k == "nats" {
+			var nats, unknownNats map[string]json.RawMessage
+			if err := json.Unmarshal(v, &unknownNats); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(m["nats"], &nats); err != nil || nats == nil {
+				nats = make(map[string]json.RawMessage)
+			}
+			for nk, nv := range unknownNats {
+				if _, ok := nats[nk]; !ok {
+					nats[nk] = nv
+				}
+			}
+			d, err := json.Marshal(nats)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = d
+		} else if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// natsData returns the serialized nats section of the claim, including fields
+// decoded from a token this version of the library doesn't model.
+func (c *ClaimsData) natsData(claim Claims) (json.RawMessage, error) {
+	j, err := json.Marshal(claim)
+	if err != nil {
+		return nil, err
+	}
+	if j, err = c.addUnknownFields(j); err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(j, &m); err != nil {
+		return nil, err
+	}
+	return m["nats"], nil
+}
+
 func (c *ClaimsData) hash() (string, error) {
 	j, err := json.Marshal(c)
 	if err != nil {
@@ -257,7 +381,13 @@ func (c *ClaimsData) verify(payload string, sig []byte) bool {
 // Validate checks a claim to make sure it is valid. Validity checks
 // include expiration and not before constraints.
 func (c *ClaimsData) Validate(vr *ValidationResults) {
-	now := time.Now().UTC().Unix()
+	c.validate(vr, 0)
+}
+
+// validate checks the claim, warning about expirations further than maxExpiration in
+// the future. Zero uses the default bound, a negative value disables the warning.
+func (c *ClaimsData) validate(vr *ValidationResults, maxExpiration time.Duration) {
+	now := Now().UTC().Unix()
 	if c.Expires > 0 && now > c.Expires {
 		vr.AddTimeCheck("claim is expired")
 	}
@@ -265,6 +395,22 @@ func (c *ClaimsData) Validate(vr *ValidationResults) {
 	if c.NotBefore > 0 && c.NotBefore > now {
 		vr.AddTimeCheck("claim is not yet valid")
 	}
+
+	if c.NotBefore > 0 && c.Expires > 0 && c.NotBefore > c.Expires {
+		vr.AddError("claim not before %d is after its expiration %d", c.NotBefore, c.Expires)
+	}
+
+	if maxExpiration == 0 {
+		maxExpiration = defaultMaxExpiration
+	}
+	if maxExpiration > 0 && c.Expires > now+int64(maxExpiration/time.Second) {
+		vr.AddWarning("claim expires more than %s in the future", maxExpiration)
+	}
+}
+
+// SigningKey returns the public key that signed the claims, the issuer
+func (c *ClaimsData) SigningKey() string {
+	return c.Issuer
 }
 
 // IsSelfSigned returns true if the claims issuer is the subject
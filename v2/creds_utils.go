@@ -17,6 +17,8 @@ package jwt
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
 	"errors"
 	"fmt"
 	"regexp"
@@ -216,3 +218,61 @@ func ParseDecoratedUserNKey(contents []byte) (nkeys.KeyPair, error) {
 	}
 	return kp, nil
 }
+
+// VerifyKeyPairFor returns an error if the public key of the key pair is not the expected one.
+// Use it to detect a wrong seed before signing with it.
+func VerifyKeyPairFor(kp nkeys.KeyPair, expectedPublic string) error {
+	if kp == nil {
+		return errors.New("keypair is required")
+	}
+	pk, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	if pk != expectedPublic {
+		return fmt.Errorf("keypair public key %q doesn't match expected key %q", pk, expectedPublic)
+	}
+	return nil
+}
+
+// VerifyCreds checks that the seed of a creds file belongs to its JWT, the public key
+// derived from the seed has to be the subject of the JWT.
+func VerifyCreds(data []byte) error {
+	token, err := ParseDecoratedJWT(data)
+	if err != nil {
+		return err
+	}
+	claims, err := Decode(token)
+	if err != nil {
+		return fmt.Errorf("error decoding creds jwt: %v", err)
+	}
+	kp, err := ParseDecoratedNKey(data)
+	if err != nil {
+		return fmt.Errorf("error parsing creds seed: %v", err)
+	}
+	defer kp.Wipe()
+	pk, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	if sub := claims.Claims().Subject; pk != sub {
+		return fmt.Errorf("creds seed is for %q but the jwt subject is %q", pk, sub)
+	}
+	return nil
+}
+
+// CredsFingerprint returns a short fingerprint identifying the user of a creds file.
+// The fingerprint is derived from the user public key in the JWT only - the seed
+// never influences it, so it is safe to log.
+func CredsFingerprint(contents []byte) (string, error) {
+	token, err := ParseDecoratedJWT(contents)
+	if err != nil {
+		return "", err
+	}
+	uc, err := DecodeUserClaims(token)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(uc.Subject))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(h[:10]), nil
+}
@@ -287,3 +287,65 @@ func Test_ParseCredsWithCrLfs(t *testing.T) {
 		t.Fatal("expected keys to match")
 	}
 }
+
+func Test_CredsFingerprint(t *testing.T) {
+	token, kp := makeJWT(t)
+	creds, err := FormatUserConfig(token, seedKey(kp, t))
+	AssertNoError(err, t)
+	fp, err := CredsFingerprint(creds)
+	AssertNoError(err, t)
+	AssertEquals(16, len(fp), t)
+
+	// same user paired with a different seed
+	other, err := FormatUserConfig(token, seedKey(createUserNKey(t), t))
+	AssertNoError(err, t)
+	fp2, err := CredsFingerprint(other)
+	AssertNoError(err, t)
+	AssertEquals(fp, fp2, t)
+	AssertFalse(strings.Contains(fp, string(seedKey(kp, t))), t)
+
+	token2, kp2 := makeJWT(t)
+	creds2, err := FormatUserConfig(token2, seedKey(kp2, t))
+	AssertNoError(err, t)
+	fp3, err := CredsFingerprint(creds2)
+	AssertNoError(err, t)
+	AssertTrue(fp != fp3, t)
+
+	if _, err := CredsFingerprint([]byte("garbage")); err == nil {
+		t.Fatal("expected an error for a bad creds file")
+	}
+}
+
+func TestVerifyKeyPairFor(t *testing.T) {
+	kp := createAccountNKey(t)
+	if err := VerifyKeyPairFor(kp, publicKey(kp, t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyKeyPairFor(kp, publicKey(createAccountNKey(t), t)); err == nil {
+		t.Fatal("expected an error for a different public key")
+	}
+	if err := VerifyKeyPairFor(nil, publicKey(kp, t)); err == nil {
+		t.Fatal("expected an error for a missing keypair")
+	}
+}
+
+func TestVerifyCreds(t *testing.T) {
+	token, kp := makeJWT(t)
+	creds, err := FormatUserConfig(token, seedKey(kp, t))
+	AssertNoError(err, t)
+	AssertNoError(VerifyCreds(creds), t)
+
+	other := createUserNKey(t)
+	creds, err = FormatUserConfig(token, seedKey(other, t))
+	AssertNoError(err, t)
+	err = VerifyCreds(creds)
+	if err == nil {
+		t.Fatal("expected an error for a mismatched seed")
+	}
+	AssertTrue(strings.Contains(err.Error(), publicKey(other, t)), t)
+	AssertTrue(strings.Contains(err.Error(), publicKey(kp, t)), t)
+
+	if err := VerifyCreds([]byte("garbage")); err == nil {
+		t.Fatal("expected an error for a bad creds file")
+	}
+}
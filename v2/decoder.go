@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 
 	"github.com/nats-io/nkeys"
@@ -56,39 +58,177 @@ type v1ClaimsDataDeletedFields struct {
 // doesn't match the expected algorithm, or the claim is
 // not valid or verification fails an error is returned.
 func Decode(token string) (Claims, error) {
+	_, claim, err := decode(token)
+	return claim, err
+}
+
+// MaxDecodeSize caps the number of bytes DecodeFrom reads from its reader
+var MaxDecodeSize int64 = 1024 * 1024
+
+// DecodeFrom reads a token from the reader and decodes it like Decode. Surrounding
+// whitespace is ignored. At most MaxDecodeSize bytes are read, larger tokens are rejected,
+// so untrusted sources can't cause unbounded reads.
+func DecodeFrom(r io.Reader) (Claims, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxDecodeSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxDecodeSize {
+		return nil, fmt.Errorf("token exceeds the maximum size of %d bytes", MaxDecodeSize)
+	}
+	return Decode(strings.TrimSpace(string(data)))
+}
+
+// DecodeUnverified decodes the claims like Decode, without verifying the signature.
+// The token still has to be well formed and its issuer a key of the expected type.
+// This is meant for inspecting tokens offline, claims decoded this way can't be trusted
+// and must never be used to authenticate or authorize.
+func DecodeUnverified(token string) (Claims, error) {
+	_, claim, err := parse(token, false)
+	return claim, err
+}
+
+// DecodeVerifyID decodes the token like Decode, additionally verifying that the
+// claim ID (jti) matches the hash of the claims data. A mismatch indicates the
+// token was tampered with or corrupted. Only tokens of the current version can
+// be verified.
+func DecodeVerifyID(token string) (Claims, error) {
+	ver, claim, err := decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if ver != libVersion {
+		return nil, fmt.Errorf("claim ID verification requires a version %d JWT", libVersion)
+	}
+	cd := *claim.Claims()
+	id := cd.ID
+	cd.ID = ""
+	expected, err := cd.hash()
+	if err != nil {
+		return nil, err
+	}
+	if id != expected {
+		return nil, errors.New("claim ID doesn't match the claims data")
+	}
+	return claim, nil
+}
+
+// maxChainLength bounds the number of issuers VerifyToAnchor walks
+const maxChainLength = 10
+
+// VerifyToAnchor verifies that the token's chain of issuers leads to one of the anchor
+// keys. Claims of intermediate issuers are retrieved by public key using resolve. Each
+// parent has to list the issuer of its child as its identity or as a signing key. A
+// signing key is resolved to the claims that list it, e.g. the operator JWT. A trusted
+// issuer_account is only accepted once its resolved claims list the signing key.
+func VerifyToAnchor(token string, anchors []string, resolve func(pub string) (string, error)) error {
+	trusted := StringList(anchors)
+	c, err := Decode(token)
+	if err != nil {
+		return err
+	}
+	visited := make(map[string]bool)
+	for depth := 0; ; depth++ {
+		cd := c.Claims()
+		parent := cd.Issuer
+		if ia := issuerAccount(c); ia != "" {
+			parent = ia
+		}
+		if trusted.Contains(cd.Issuer) {
+			return nil
+		}
+		if parent == cd.Subject {
+			return fmt.Errorf("chain ends at untrusted %s", parent)
+		}
+		if visited[parent] || depth >= maxChainLength {
+			return fmt.Errorf("issuer chain of %s loops or is too long", cd.Subject)
+		}
+		visited[parent] = true
+		if resolve == nil {
+			return fmt.Errorf("issuer %s is not trusted", parent)
+		}
+		pt, err := resolve(parent)
+		if err != nil {
+			return fmt.Errorf("resolving issuer %s: %v", parent, err)
+		}
+		pc, err := Decode(pt)
+		if err != nil {
+			return fmt.Errorf("decoding issuer %s: %v", parent, err)
+		}
+		var keys StringList
+		switch p := pc.(type) {
+		case *OperatorClaims:
+			keys = p.SigningKeys
+		case *AccountClaims:
+			keys = StringList(p.SigningKeys.Keys())
+		default:
+			return fmt.Errorf("issuer %s resolved to a %s jwt", parent, pc.ClaimType())
+		}
+		psub := pc.Claims().Subject
+		if psub != parent && !keys.Contains(parent) {
+			return fmt.Errorf("issuer %s resolved to unrelated jwt of %s", parent, psub)
+		}
+		if cd.Issuer != psub && !keys.Contains(cd.Issuer) {
+			return fmt.Errorf("%s is not a signing key of %s", cd.Issuer, psub)
+		}
+		if trusted.Contains(parent) {
+			return nil
+		}
+		c = pc
+	}
+}
+
+// issuerAccount returns the account a signing key issued the claim on behalf of
+func issuerAccount(c Claims) string {
+	switch v := c.(type) {
+	case *UserClaims:
+		return v.IssuerAccount
+	case *ActivationClaims:
+		return v.IssuerAccount
+	}
+	return ""
+}
+
+func decode(token string) (int, Claims, error) {
+	return parse(token, true)
+}
+
+func parse(token string, verifySignature bool) (int, Claims, error) {
 	// must have 3 chunks
 	chunks := strings.Split(token, ".")
 	if len(chunks) != 3 {
-		return nil, errors.New("expected 3 chunks")
+		return -1, nil, errors.New("expected 3 chunks")
 	}
 
 	// header
 	if _, err := parseHeaders(chunks[0]); err != nil {
-		return nil, err
+		return -1, nil, err
 	}
 	// claim
 	data, err := decodeString(chunks[1])
 	if err != nil {
-		return nil, err
+		return -1, nil, err
 	}
 	ver, claim, err := loadClaims(data)
 	if err != nil {
-		return nil, err
+		return -1, nil, err
 	}
 
 	// sig
 	sig, err := decodeString(chunks[2])
 	if err != nil {
-		return nil, err
+		return -1, nil, err
 	}
 
-	if ver <= 1 {
-		if !claim.verify(chunks[1], sig) {
-			return nil, errors.New("claim failed V1 signature verification")
-		}
-	} else {
-		if !claim.verify(token[:len(chunks[0])+len(chunks[1])+1], sig) {
-			return nil, errors.New("claim failed V2 signature verification")
+	if verifySignature {
+		if ver <= 1 {
+			if !claim.verify(chunks[1], sig) {
+				return -1, nil, errors.New("claim failed V1 signature verification")
+			}
+		} else {
+			if !claim.verify(token[:len(chunks[0])+len(chunks[1])+1], sig) {
+				return -1, nil, errors.New("claim failed V2 signature verification")
+			}
 		}
 	}
 
@@ -113,10 +253,10 @@ func Decode(token string) (Claims, error) {
 			}
 		}
 		if !ok {
-			return nil, fmt.Errorf("unable to validate expected prefixes - %v", prefixes)
+			return -1, nil, fmt.Errorf("unable to validate expected prefixes - %v", prefixes)
 		}
 	}
-	return claim, nil
+	return ver, claim, nil
 }
 
 func loadClaims(data []byte) (int, Claims, error) {
@@ -151,6 +291,14 @@ func loadClaims(data []byte) (int, Claims, error) {
 		}
 		return -1, &gc, nil
 	}
-
-	return id.Version(), claim, err
+	if err != nil {
+		return -1, nil, err
+	}
+	// migrated claims have a different layout, so only current versions keep unknown fields
+	if id.Version() == libVersion {
+		if err := claim.Claims().setUnknownFields(data, claim); err != nil {
+			return -1, nil, err
+		}
+	}
+	return id.Version(), claim, nil
 }
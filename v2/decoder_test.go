@@ -399,3 +399,274 @@ func TestUsingURLDecoder(t *testing.T) {
 		t.Fatal("should have returned activation")
 	}
 }
+
+func TestUnknownFieldsRoundTrip(t *testing.T) {
+	akp := createAccountNKey(t)
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Name = "A"
+	token := encode(account, okp, t)
+
+	// simulate a token produced by a newer library with additional fields
+	token = resign(t, token, okp, func(m map[string]interface{}) {
+		m["future"] = "top"
+		m["nats"].(map[string]interface{})["future_nats"] = 42
+	})
+
+	decoded, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	decoded.Name = "B"
+	reEncoded := encode(decoded, okp, t)
+
+	data, err := decodeString(strings.Split(reEncoded, ".")[1])
+	AssertNoError(err, t)
+	var m map[string]interface{}
+	AssertNoError(json.Unmarshal(data, &m), t)
+	AssertEquals("top", m["future"], t)
+	AssertEquals(float64(42), m["nats"].(map[string]interface{})["future_nats"], t)
+	AssertEquals("B", m["name"], t)
+
+	again, err := DecodeAccountClaims(reEncoded)
+	AssertNoError(err, t)
+	AssertEquals("B", again.Name, t)
+	AssertEquals(account.Subject, again.Subject, t)
+}
+
+func TestAccountNatsData(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Exports.Add(&Export{Subject: "foo", Type: Stream})
+	token := encode(account, okp, t)
+	token = resign(t, token, okp, func(m map[string]interface{}) {
+		m["nats"].(map[string]interface{})["future_nats"] = "later"
+	})
+
+	decoded, err := DecodeAccountClaims(token)
+	AssertNoError(err, t)
+	var raw map[string]json.RawMessage
+	AssertNoError(json.Unmarshal(decoded.NatsData(), &raw), t)
+	AssertEquals(`"later"`, string(raw["future_nats"]), t)
+	AssertTrue(raw["exports"] != nil, t)
+
+	var future struct {
+		FutureNats string `json:"future_nats"`
+		Exports    []struct {
+			Subject string `json:"subject"`
+		} `json:"exports"`
+	}
+	AssertNoError(decoded.DecodeNatsData(&future), t)
+	AssertEquals("later", future.FutureNats, t)
+	AssertEquals("foo", future.Exports[0].Subject, t)
+}
+
+// resign modifies the payload of a token and signs it again with kp
+func resign(t *testing.T, token string, kp nkeys.KeyPair, modify func(m map[string]interface{})) string {
+	chunks := strings.Split(token, ".")
+	data, err := decodeString(chunks[1])
+	AssertNoError(err, t)
+	var m map[string]interface{}
+	AssertNoError(json.Unmarshal(data, &m), t)
+	modify(m)
+	payload, err := serialize(m)
+	AssertNoError(err, t)
+	toSign := fmt.Sprintf("%s.%s", chunks[0], payload)
+	sig, err := kp.Sign([]byte(toSign))
+	AssertNoError(err, t)
+	return fmt.Sprintf("%s.%s", toSign, encodeToString(sig))
+}
+
+func TestDecodeVerifyID(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	token := encode(account, okp, t)
+
+	c, err := DecodeVerifyID(token)
+	AssertNoError(err, t)
+	AssertEquals(account.ID, c.Claims().ID, t)
+
+	tampered := resign(t, token, okp, func(m map[string]interface{}) {
+		m["jti"] = "TAMPERED"
+	})
+	if _, err := Decode(tampered); err != nil {
+		t.Fatal("decode should be lenient about the jti", err)
+	}
+	if _, err := DecodeVerifyID(tampered); err == nil {
+		t.Fatal("tampered jti should fail verification")
+	}
+
+	tampered = resign(t, token, okp, func(m map[string]interface{}) {
+		m["name"] = "changed"
+	})
+	if _, err := DecodeVerifyID(tampered); err == nil {
+		t.Fatal("modified claims data should fail verification")
+	}
+}
+
+func TestVerifyToAnchor(t *testing.T) {
+	okp := createOperatorNKey(t)
+	opk := publicKey(okp, t)
+	oskp := createOperatorNKey(t)
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	askp := createAccountNKey(t)
+
+	oc := NewOperatorClaims(opk)
+	oc.SigningKeys.Add(publicKey(oskp, t))
+	operator := encode(oc, okp, t)
+
+	ac := NewAccountClaims(apk)
+	ac.SigningKeys.Add(publicKey(askp, t))
+	account := encode(ac, oskp, t)
+
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+	uc.IssuerAccount = apk
+	user := encode(uc, askp, t)
+
+	tokens := map[string]string{apk: account, publicKey(oskp, t): operator}
+	resolve := func(pub string) (string, error) {
+		if token, ok := tokens[pub]; ok {
+			return token, nil
+		}
+		return "", fmt.Errorf("%s not found", pub)
+	}
+
+	AssertNoError(VerifyToAnchor(user, []string{opk}, resolve), t)
+	AssertNoError(VerifyToAnchor(account, []string{opk}, resolve), t)
+	AssertNoError(VerifyToAnchor(user, []string{apk}, resolve), t)
+	if err := VerifyToAnchor(user, []string{apk}, nil); err == nil {
+		t.Fatal("a trusted issuer account can't be verified without resolving it")
+	}
+
+	// a user signed by an unrelated key claiming a trusted issuer account
+	forged := NewUserClaims(publicKey(createUserNKey(t), t))
+	forged.IssuerAccount = apk
+	forgedToken := encode(forged, createAccountNKey(t), t)
+	if err := VerifyToAnchor(forgedToken, []string{apk}, resolve); err == nil {
+		t.Fatal("forged issuer account should fail")
+	}
+	if err := VerifyToAnchor(forgedToken, []string{opk}, resolve); err == nil {
+		t.Fatal("forged issuer account should fail")
+	}
+
+	// the operator is not an anchor
+	if err := VerifyToAnchor(user, []string{publicKey(createOperatorNKey(t), t)}, resolve); err == nil {
+		t.Fatal("chain to an untrusted operator should fail")
+	}
+
+	// missing parent
+	delete(tokens, apk)
+	if err := VerifyToAnchor(user, []string{opk}, resolve); err == nil {
+		t.Fatal("chain with a missing parent should fail")
+	}
+
+	// the signing key is not listed by the resolved account
+	tokens[apk] = encode(NewAccountClaims(apk), oskp, t)
+	if err := VerifyToAnchor(user, []string{opk}, resolve); err == nil {
+		t.Fatal("chain with an unlisted signing key should fail")
+	}
+
+	// a parent resolving to itself loops
+	loop := NewAccountClaims(apk)
+	loop.SigningKeys.Add(publicKey(askp, t))
+	tokens[apk] = encode(loop, askp, t)
+	tokens[publicKey(askp, t)] = tokens[apk]
+	if err := VerifyToAnchor(user, []string{opk}, resolve); err == nil {
+		t.Fatal("looping chain should fail")
+	}
+}
+
+func TestInvertedTimeBounds(t *testing.T) {
+	c := NewGenericClaims(publicKey(createAccountNKey(t), t))
+	c.NotBefore = time.Now().Add(2 * time.Hour).Unix()
+	c.Expires = time.Now().Add(time.Hour).Unix()
+
+	vr := CreateValidationResults()
+	c.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("not before after expiration should be blocking")
+	}
+
+	c.Expires = 0
+	vr = CreateValidationResults()
+	c.Validate(vr)
+	if vr.IsBlocking(false) {
+		t.Fatal("not before without expiration should not be blocking")
+	}
+}
+
+func TestFarFutureExpiration(t *testing.T) {
+	c := NewGenericClaims(publicKey(createAccountNKey(t), t))
+	c.Expires = time.Now().Add(11 * 365 * 24 * time.Hour).Unix()
+
+	vr := CreateValidationResults()
+	c.Validate(vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertFalse(vr.IsBlocking(true), t)
+
+	u := NewUserClaims(publicKey(createUserNKey(t), t))
+	u.Expires = c.Expires
+	vr = CreateValidationResults()
+	u.ValidateWithOptions(vr, ValidateOptions{})
+	AssertEquals(1, len(vr.Warnings()), t)
+
+	vr = CreateValidationResults()
+	u.ValidateWithOptions(vr, ValidateOptions{MaxExpiration: 20 * 365 * 24 * time.Hour})
+	AssertTrue(vr.IsEmpty(), t)
+
+	vr = CreateValidationResults()
+	u.ValidateWithOptions(vr, ValidateOptions{MaxExpiration: time.Hour})
+	AssertEquals(1, len(vr.Warnings()), t)
+
+	u.Expires = time.Now().Add(100 * 365 * 24 * time.Hour).Unix()
+	vr = CreateValidationResults()
+	u.ValidateWithOptions(vr, ValidateOptions{MaxExpiration: -1})
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestDecodeUnverified(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Name = "inspected"
+	// signed with a key that is not the issuer
+	token := resign(t, encode(account, okp, t), createOperatorNKey(t), func(m map[string]interface{}) {})
+
+	if _, err := Decode(token); err == nil {
+		t.Fatal("signature should not verify")
+	}
+	c, err := DecodeUnverified(token)
+	AssertNoError(err, t)
+	ac, ok := c.(*AccountClaims)
+	AssertTrue(ok, t)
+	AssertEquals("inspected", ac.Name, t)
+	AssertEquals(publicKey(okp, t), ac.Issuer, t)
+
+	// structural checks still apply
+	if _, err := DecodeUnverified("a.b"); err == nil {
+		t.Fatal("expected an error for a malformed token")
+	}
+	bad := resign(t, token, okp, func(m map[string]interface{}) {
+		m["iss"] = publicKey(createUserNKey(t), t)
+	})
+	if _, err := DecodeUnverified(bad); err == nil {
+		t.Fatal("expected an error for an issuer of the wrong type")
+	}
+}
+
+func TestDecodeFrom(t *testing.T) {
+	okp := createOperatorNKey(t)
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	token := encode(account, okp, t)
+
+	c, err := DecodeFrom(strings.NewReader(token + "\n"))
+	AssertNoError(err, t)
+	AssertEquals(account.Subject, c.Claims().Subject, t)
+
+	defer func(max int64) { MaxDecodeSize = max }(MaxDecodeSize)
+	MaxDecodeSize = int64(len(token)) - 1
+	if _, err := DecodeFrom(strings.NewReader(token)); err == nil {
+		t.Fatal("expected an error for a token exceeding the maximum size")
+	}
+	MaxDecodeSize = int64(len(token))
+	_, err = DecodeFrom(strings.NewReader(token))
+	AssertNoError(err, t)
+}
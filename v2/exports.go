@@ -18,8 +18,11 @@ package jwt
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/nats-io/nkeys"
 )
 
 // ResponseType is used to store an export response type
@@ -107,6 +110,30 @@ func (sl *ServiceLatency) Validate(vr *ValidationResults) {
 	}
 }
 
+// MsgTrace configures message tracing for an export. Unlike ServiceLatency, which
+// measures the responses of a service, traces describe how messages on the exported
+// subjects are delivered, and can be enabled for streams and services.
+// Sampling 1-100, represents the percentage of messages traced.
+// Destination is the subject where the traces are published.
+type MsgTrace struct {
+	Sampling    int     `json:"sampling"`
+	Destination Subject `json:"destination"`
+}
+
+// Validate checks the sampling rate and destination of the trace configuration
+func (mt *MsgTrace) Validate(vr *ValidationResults) {
+	if mt.Sampling < 1 || mt.Sampling > 100 {
+		vr.AddError("trace sampling percentage needs to be between 1-100")
+	}
+	mt.Destination.Validate(vr)
+	if mt.Destination.HasWildCards() {
+		vr.AddError("trace destination subject can not contain wildcards")
+	}
+}
+
+// sysPrefix covers the system event and request subjects
+const sysPrefix = Subject("$SYS.>")
+
 // Export represents a single export
 type Export struct {
 	Name                 string          `json:"name,omitempty"`
@@ -118,9 +145,39 @@ type Export struct {
 	ResponseThreshold    time.Duration   `json:"response_threshold,omitempty"`
 	Latency              *ServiceLatency `json:"service_latency,omitempty"`
 	AccountTokenPosition uint            `json:"account_token_position,omitempty"`
+	// AllowedAccounts pins the public keys of the accounts allowed to import.
+	// When set, an activation token is not required from a listed account.
+	AllowedAccounts StringList `json:"allowed_accounts,omitempty"`
+	// MaxTokenExpiry caps how long activations issued for this export may be valid.
+	// Zero means no cap.
+	MaxTokenExpiry time.Duration `json:"max_token_expiry,omitempty"`
+	// ExpectedConsumers is informational only, it hints at the expected fan-out
+	// for capacity planning and has no effect on authorization.
+	ExpectedConsumers int `json:"expected_consumers,omitempty"`
+	// Inactive deactivates the export without removing it, it no longer authorizes
+	// imports. Exports are active unless explicitly deactivated.
+	Inactive bool `json:"inactive,omitempty"`
+	// DisallowShare rejects imports that share importer information (for latency tracking)
+	// with this service.
+	DisallowShare bool `json:"disallow_share,omitempty"`
+	// AllowSystemEvents acknowledges that the export exposes $SYS subjects,
+	// such exports are rejected without it.
+	AllowSystemEvents bool `json:"allow_system_events,omitempty"`
+	// RequiredImporterTags lists tags an account needs to carry to import the export
+	RequiredImporterTags TagList `json:"required_importer_tags,omitempty"`
+	// ResponseSubject is a template for the subject responses are published to, tokens of the
+	// form $N are replaced by the request subject token matched by the Nth wildcard
+	ResponseSubject Subject `json:"response_subject,omitempty"`
+	// Trace enables message tracing of the exported subjects
+	Trace *MsgTrace `json:"msg_trace,omitempty"`
 	Info
 }
 
+// IsActive returns true if the export authorizes imports
+func (e *Export) IsActive() bool {
+	return !e.Inactive
+}
+
 // IsService returns true if an export is for a service
 func (e *Export) IsService() bool {
 	return e.Type == Service
@@ -168,13 +225,38 @@ func (e *Export) Validate(vr *ValidationResults) {
 		}
 		e.Latency.Validate(vr)
 	}
+	if e.Trace != nil {
+		e.Trace.Validate(vr)
+	}
+	if e.ResponseSubject != "" {
+		e.validateResponseSubject(vr)
+	}
 	if e.ResponseThreshold.Nanoseconds() < 0 {
 		vr.AddError("negative response threshold is invalid")
 	}
 	if e.ResponseThreshold.Nanoseconds() > 0 && !e.IsService() {
 		vr.AddError("response threshold only valid for services")
 	}
+	if e.DisallowShare && !e.IsService() {
+		vr.AddError("disallowing information sharing is only valid for services: %q", e.Subject)
+	}
+	if e.MaxTokenExpiry < 0 {
+		vr.AddError("negative max token expiry is invalid")
+	}
+	if e.ExpectedConsumers < 0 {
+		vr.AddError("negative expected consumers is invalid")
+	}
 	e.Subject.Validate(vr)
+	if e.Subject.IsContainedIn(sysPrefix) && !e.AllowSystemEvents {
+		vr.AddError("export %q exposes system events, this requires allow system events to be set", e.Subject)
+	}
+	if e.IsService() && e.Subject == ">" {
+		vr.AddWarning("service export %q exports all requests of the account, consider narrowing the subject", e.Subject)
+	}
+	if e.TokenReq && e.Subject.HasWildCards() && e.AccountTokenPosition == 0 {
+		vr.AddWarning("export %q requires a token and has wildcards but no account token position, "+
+			"importers can't be told apart by subject", e.Subject)
+	}
 	if e.AccountTokenPosition > 0 {
 		if !e.Subject.HasWildCards() {
 			vr.AddError("Account Token Position can only be used with wildcard subjects: %s", e.Subject)
@@ -191,12 +273,52 @@ func (e *Export) Validate(vr *ValidationResults) {
 			}
 		}
 	}
+	for _, a := range e.AllowedAccounts {
+		if !nkeys.IsValidPublicAccountKey(a) {
+			vr.AddError("allowed account %q of export %q is not an account public key", a, e.Subject)
+		}
+	}
 	e.Info.Validate(vr)
 }
 
-// Revoke enters a revocation by publickey using time.Now().
+// validateResponseSubject checks that the response subject template is only used by services
+// and that its $N references are in range of the wildcards of the export subject
+func (e *Export) validateResponseSubject(vr *ValidationResults) {
+	if !e.IsService() {
+		vr.AddError("response subject only valid for services: %q", e.Subject)
+	}
+	e.ResponseSubject.Validate(vr)
+	if e.ResponseSubject.HasWildCards() {
+		vr.AddError("response subject %q can not contain wildcards", e.ResponseSubject)
+	}
+	wildcards := e.Subject.singleWildcards()
+	for _, c := range e.ResponseSubject.captures() {
+		if c.n < 1 || c.n > wildcards {
+			vr.AddError("response subject %q references %s but export %q has %d wildcards",
+				e.ResponseSubject, c.token, e.Subject, wildcards)
+		}
+	}
+}
+
+// ValidateResponsePermission checks that the response permission of users responding
+// to the service allows the number of responses its response type implies. A max of
+// 0 allows the server default of a single response, a negative max is unlimited.
+func (e *Export) ValidateResponsePermission(rp *ResponsePermission, vr *ValidationResults) {
+	if rp == nil || !e.IsService() {
+		return
+	}
+	if (e.IsChunkedResponse() || e.IsStreamResponse()) && rp.MaxMsgs >= 0 && rp.MaxMsgs <= 1 {
+		vr.AddWarning("%s response service %q can't respond with more than a single message, "+
+			"the response permission allows %d", e.ResponseType, e.Subject, rp.MaxMsgs)
+	}
+	if e.IsSingleResponse() && (rp.MaxMsgs > 1 || rp.MaxMsgs < 0) {
+		vr.AddWarning("singleton response service %q is allowed more responses than it sends", e.Subject)
+	}
+}
+
+// Revoke enters a revocation by publickey using Now().
 func (e *Export) Revoke(pubKey string) {
-	e.RevokeAt(pubKey, time.Now())
+	e.RevokeAt(pubKey, Now())
 }
 
 // RevokeAt enters a revocation by publickey and timestamp into this export
@@ -230,14 +352,110 @@ func (e *Export) IsClaimRevoked(claim *ActivationClaims) bool {
 	return e.isRevoked(claim.Subject, time.Unix(claim.IssuedAt, 0))
 }
 
+// ExportBuilder assembles an export step by step, Build validates the result
+type ExportBuilder struct {
+	export Export
+}
+
+// NewExportBuilder starts building an export of the subject and type
+func NewExportBuilder(subject Subject, typ ExportType) *ExportBuilder {
+	return &ExportBuilder{export: Export{Subject: subject, Type: typ}}
+}
+
+// WithName sets the name of the export
+func (b *ExportBuilder) WithName(name string) *ExportBuilder {
+	b.export.Name = name
+	return b
+}
+
+// WithTokenReq requires importers to present an activation token
+func (b *ExportBuilder) WithTokenReq() *ExportBuilder {
+	b.export.TokenReq = true
+	return b
+}
+
+// WithResponseType sets the response type of a service export
+func (b *ExportBuilder) WithResponseType(rt ResponseType) *ExportBuilder {
+	b.export.ResponseType = rt
+	return b
+}
+
+// WithResponseThreshold sets the response threshold of a service export
+func (b *ExportBuilder) WithResponseThreshold(d time.Duration) *ExportBuilder {
+	b.export.ResponseThreshold = d
+	return b
+}
+
+// WithLatency enables latency tracking of a service export
+func (b *ExportBuilder) WithLatency(sampling SamplingRate, results Subject) *ExportBuilder {
+	b.export.Latency = &ServiceLatency{Sampling: sampling, Results: results}
+	return b
+}
+
+// WithAccountTokenPosition sets the wildcard token that has to match the importing account
+func (b *ExportBuilder) WithAccountTokenPosition(pos uint) *ExportBuilder {
+	b.export.AccountTokenPosition = pos
+	return b
+}
+
+// WithAllowedAccounts pins the accounts allowed to import the export
+func (b *ExportBuilder) WithAllowedAccounts(accounts ...string) *ExportBuilder {
+	b.export.AllowedAccounts.Add(accounts...)
+	return b
+}
+
+// Build validates and returns the export. Warnings don't fail the build,
+// blocking issues are returned as an error.
+func (b *ExportBuilder) Build() (*Export, error) {
+	e := b.export
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	if vr.IsBlocking(false) {
+		var msgs []string
+		for _, err := range vr.Errors() {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, fmt.Errorf("invalid export %q: %s", e.Subject, strings.Join(msgs, "; "))
+	}
+	return &e, nil
+}
+
 // Exports is a slice of exports
 type Exports []*Export
 
-// Add appends exports to the list
+// Add appends exports to the list. Exports with the same subject and type are kept,
+// Validate reports them, use Dedupe to collapse them.
 func (e *Exports) Add(i ...*Export) {
 	*e = append(*e, i...)
 }
 
+// Dedupe collapses exports with identical subject and type, keeping the first one.
+// Returns the exports that were removed.
+func (e *Exports) Dedupe() []*Export {
+	type key struct {
+		subject Subject
+		typ     ExportType
+	}
+	seen := make(map[key]bool, len(*e))
+	var kept Exports
+	var removed []*Export
+	for _, v := range *e {
+		if v == nil {
+			kept = append(kept, v)
+			continue
+		}
+		k := key{v.Subject, v.Type}
+		if seen[k] {
+			removed = append(removed, v)
+			continue
+		}
+		seen[k] = true
+		kept = append(kept, v)
+	}
+	*e = kept
+	return removed
+}
+
 func isContainedIn(kind ExportType, subjects []Subject, vr *ValidationResults) {
 	m := make(map[string]string)
 	for i, ns := range subjects {
@@ -259,7 +477,11 @@ func isContainedIn(kind ExportType, subjects []Subject, vr *ValidationResults) {
 		for k, v := range m {
 			var vi ValidationIssue
 			vi.Blocking = true
-			vi.Description = fmt.Sprintf("%s export subject %q already exports %q", kind, k, v)
+			if k == v {
+				vi.Description = fmt.Sprintf("%s export subject %q is exported more than once", kind, k)
+			} else {
+				vi.Description = fmt.Sprintf("%s export subject %q already exports %q", kind, k, v)
+			}
 			vr.Add(&vi)
 		}
 	}
@@ -299,6 +521,25 @@ func (e *Exports) HasExportContainingSubject(subject Subject) bool {
 	return false
 }
 
+// MatchingExport returns the active export that covers the subject and type of the import, or nil.
+// Inactive exports don't authorize imports and are never returned.
+func (e *Exports) MatchingExport(i *Import) *Export {
+	return e.matchingExport(i, false)
+}
+
+func (e *Exports) matchingExport(i *Import, includeInactive bool) *Export {
+	if i == nil {
+		return nil
+	}
+	subj := i.exportSubject()
+	for _, v := range *e {
+		if v != nil && v.Type == i.Type && subj.IsContainedIn(v.Subject) && (includeInactive || v.IsActive()) {
+			return v
+		}
+	}
+	return nil
+}
+
 func (e Exports) Len() int {
 	return len(e)
 }
@@ -307,6 +548,63 @@ func (e Exports) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
+// Less orders exports by type, subject and name so encoded accounts are stable
 func (e Exports) Less(i, j int) bool {
-	return e[i].Subject < e[j].Subject
+	if e[i].Type != e[j].Type {
+		return e[i].Type < e[j].Type
+	}
+	if e[i].Subject != e[j].Subject {
+		return e[i].Subject < e[j].Subject
+	}
+	return e[i].Name < e[j].Name
+}
+
+// AuditExportConflicts reports token required exports of different accounts that offer
+// overlapping subjects to the same importer. Importers are the allowed accounts of an
+// export, an export without allowed accounts is offered to any account.
+func AuditExportConflicts(accounts []*AccountClaims) []string {
+	type offer struct {
+		account string
+		export  *Export
+	}
+	var offers []offer
+	for _, a := range accounts {
+		if a == nil {
+			continue
+		}
+		for _, e := range a.Exports {
+			if e != nil && e.TokenReq && e.IsActive() {
+				offers = append(offers, offer{a.Subject, e})
+			}
+		}
+	}
+	var conflicts []string
+	for i, o := range offers {
+		for _, p := range offers[i+1:] {
+			if o.account == p.account || o.export.Type != p.export.Type || !o.export.Subject.overlaps(p.export.Subject) {
+				continue
+			}
+			var importers []string
+			switch {
+			case len(o.export.AllowedAccounts) == 0 && len(p.export.AllowedAccounts) == 0:
+				importers = []string{"any account"}
+			case len(o.export.AllowedAccounts) == 0:
+				importers = p.export.AllowedAccounts
+			case len(p.export.AllowedAccounts) == 0:
+				importers = o.export.AllowedAccounts
+			default:
+				for _, k := range o.export.AllowedAccounts {
+					if p.export.AllowedAccounts.Contains(k) {
+						importers = append(importers, k)
+					}
+				}
+			}
+			for _, k := range importers {
+				conflicts = append(conflicts, fmt.Sprintf("accounts %s and %s both export %s %q and %q to %s",
+					o.account, p.account, o.export.Type, o.export.Subject, p.export.Subject, k))
+			}
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
 }
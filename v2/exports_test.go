@@ -17,6 +17,7 @@ package jwt
 
 import (
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -343,6 +344,26 @@ func TestExport_Sorting(t *testing.T) {
 	}
 }
 
+func TestExport_SortingByTypeSubjectName(t *testing.T) {
+	var exports Exports
+	exports.Add(&Export{Subject: "a", Type: Service, Name: "b"})
+	exports.Add(&Export{Subject: "b", Type: Stream})
+	exports.Add(&Export{Subject: "a", Type: Service, Name: "a"})
+	exports.Add(&Export{Subject: "a", Type: Stream})
+	sort.Sort(exports)
+
+	expected := []struct {
+		t ExportType
+		s Subject
+		n string
+	}{{Stream, "a", ""}, {Stream, "b", ""}, {Service, "a", "a"}, {Service, "a", "b"}}
+	for i, e := range expected {
+		if exports[i].Type != e.t || exports[i].Subject != e.s || exports[i].Name != e.n {
+			t.Fatalf("unexpected export at %d: %v %q %q", i, exports[i].Type, exports[i].Subject, exports[i].Name)
+		}
+	}
+}
+
 func TestExportAccountTokenPos(t *testing.T) {
 	okp := createOperatorNKey(t)
 	akp := createAccountNKey(t)
@@ -440,3 +461,269 @@ func TestExport_ResponseThreshold(t *testing.T) {
 		t.Fatal("expected this to fail due to negative duration")
 	}
 }
+
+func TestExportAllowedAccountsValidation(t *testing.T) {
+	e := &Export{Subject: "foo", Type: Stream, TokenReq: true}
+	e.AllowedAccounts.Add(publicKey(createUserNKey(t), t))
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("allowed accounts have to be account public keys")
+	}
+}
+
+func TestExportMaxTokenExpiryValidation(t *testing.T) {
+	e := &Export{Subject: "foo", Type: Stream, TokenReq: true, MaxTokenExpiry: -time.Second}
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("negative max token expiry should be blocking")
+	}
+}
+
+func TestExportExpectedConsumers(t *testing.T) {
+	e := &Export{Subject: "foo", Type: Stream, ExpectedConsumers: -1}
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("negative expected consumers should be blocking")
+	}
+
+	akp := createAccountNKey(t)
+	account := NewAccountClaims(publicKey(akp, t))
+	account.Exports.Add(&Export{Subject: "foo", Type: Stream, ExpectedConsumers: 25})
+	ac, err := DecodeAccountClaims(encode(account, akp, t))
+	AssertNoError(err, t)
+	AssertEquals(25, ac.Exports[0].ExpectedConsumers, t)
+	vr = CreateValidationResults()
+	ac.Exports.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestServiceExportFullWildcard(t *testing.T) {
+	for _, test := range []struct {
+		e    Export
+		warn bool
+	}{
+		{Export{Subject: ">", Type: Service}, true},
+		{Export{Subject: "svc.>", Type: Service}, false},
+		{Export{Subject: ">", Type: Stream}, false},
+	} {
+		vr := CreateValidationResults()
+		test.e.Validate(vr)
+		AssertEquals(test.warn, len(vr.Warnings()) == 1, t)
+		AssertFalse(vr.IsBlocking(true), t)
+	}
+}
+
+func TestExportBuilder(t *testing.T) {
+	e, err := NewExportBuilder("svc.*", Service).
+		WithName("svc").
+		WithTokenReq().
+		WithResponseType(ResponseTypeStream).
+		WithResponseThreshold(time.Second).
+		WithLatency(50, "svc.latency").
+		WithAccountTokenPosition(2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals("svc", e.Name, t)
+	AssertEquals(Subject("svc.*"), e.Subject, t)
+	AssertTrue(e.IsService(), t)
+	AssertTrue(e.TokenReq, t)
+	AssertTrue(e.IsStreamResponse(), t)
+	AssertEquals(time.Second, e.ResponseThreshold, t)
+	AssertEquals(SamplingRate(50), e.Latency.Sampling, t)
+	AssertEquals(uint(2), e.AccountTokenPosition, t)
+
+	if _, err := NewExportBuilder("stream", Stream).WithLatency(100, "latency").Build(); err == nil {
+		t.Fatal("latency on a stream export should fail to build")
+	} else {
+		AssertTrue(strings.Contains(err.Error(), "latency"), t)
+	}
+	if _, err := NewExportBuilder("svc", Service).WithResponseType("bad").Build(); err == nil {
+		t.Fatal("invalid response type should fail to build")
+	}
+}
+
+func TestExportResponsePermissionCrossCheck(t *testing.T) {
+	chunked := &Export{Subject: "chunked", Type: Service, ResponseType: ResponseTypeChunked}
+	for max, warn := range map[int]bool{0: true, 1: true, 2: false, -1: false} {
+		vr := CreateValidationResults()
+		chunked.ValidateResponsePermission(&ResponsePermission{MaxMsgs: max}, vr)
+		AssertEquals(warn, len(vr.Warnings()) == 1, t)
+		AssertFalse(vr.IsBlocking(true), t)
+	}
+
+	singleton := &Export{Subject: "single", Type: Service}
+	for max, warn := range map[int]bool{0: false, 1: false, 5: true, -1: true} {
+		vr := CreateValidationResults()
+		singleton.ValidateResponsePermission(&ResponsePermission{MaxMsgs: max}, vr)
+		AssertEquals(warn, len(vr.Warnings()) == 1, t)
+	}
+
+	// accounts check their exports against the default response permission
+	account := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	account.Exports.Add(chunked)
+	account.DefaultPermissions.Sub.Allow.Add("chunked")
+	account.DefaultPermissions.Resp = &ResponsePermission{MaxMsgs: 1, Expires: time.Second}
+	vr := CreateValidationResults()
+	account.Validate(vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+
+	account.DefaultPermissions.Resp.MaxMsgs = 10
+	vr = CreateValidationResults()
+	account.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestSystemEventExport(t *testing.T) {
+	for _, subj := range []Subject{"$SYS.>", "$SYS.ACCOUNT.*.CONNECT", "$SYS.SERVER.>"} {
+		e := &Export{Subject: subj, Type: Stream}
+		vr := CreateValidationResults()
+		e.Validate(vr)
+		if !vr.IsBlocking(false) {
+			t.Fatalf("export of %q without acknowledgment should be blocking", subj)
+		}
+
+		e.AllowSystemEvents = true
+		vr = CreateValidationResults()
+		e.Validate(vr)
+		if !vr.IsEmpty() {
+			t.Fatalf("acknowledged export of %q should be valid: %v", subj, vr.Issues)
+		}
+	}
+
+	vr := CreateValidationResults()
+	(&Export{Subject: "SYS.events", Type: Stream}).Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestTokenReqWildcardWithoutTokenPosition(t *testing.T) {
+	e := &Export{Subject: "svc.*", Type: Service, TokenReq: true}
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	AssertFalse(vr.IsBlocking(true), t)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], "account token position"), t)
+
+	e.AccountTokenPosition = 2
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// no warning without token requirement or without wildcards
+	vr = CreateValidationResults()
+	(&Export{Subject: "svc.*", Type: Service}).Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	vr = CreateValidationResults()
+	(&Export{Subject: "svc.a", Type: Service, TokenReq: true}).Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestExportMsgTrace(t *testing.T) {
+	e := &Export{Subject: "orders.>", Type: Stream, Trace: &MsgTrace{Sampling: 10, Destination: "trace.orders"}}
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	for _, s := range []int{0, -1, 101} {
+		e.Trace.Sampling = s
+		vr = CreateValidationResults()
+		e.Validate(vr)
+		AssertTrue(vr.IsBlocking(false), t)
+	}
+
+	e.Trace.Sampling = 100
+	e.Trace.Destination = "trace.*"
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+	e.Trace.Destination = ""
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+
+	// tracing is available to services alongside latency tracking
+	svc := &Export{Subject: "svc", Type: Service,
+		Latency: &ServiceLatency{Sampling: 50, Results: "latency"},
+		Trace:   &MsgTrace{Sampling: 1, Destination: "trace.svc"}}
+	vr = CreateValidationResults()
+	svc.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestExportsDedupe(t *testing.T) {
+	var exports Exports
+	first := &Export{Name: "first", Subject: "bar", Type: Service}
+	exports.Add(first, &Export{Subject: "bar", Type: Stream}, &Export{Name: "second", Subject: "bar", Type: Service})
+	AssertEquals(3, len(exports), t)
+
+	vr := CreateValidationResults()
+	exports.Validate(vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "more than once"), t)
+
+	removed := exports.Dedupe()
+	AssertEquals(1, len(removed), t)
+	AssertEquals("second", removed[0].Name, t)
+	AssertEquals(2, len(exports), t)
+	AssertTrue(exports[0] == first, t)
+
+	vr = CreateValidationResults()
+	exports.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	AssertEquals(0, len(exports.Dedupe()), t)
+}
+
+func TestExportResponseSubject(t *testing.T) {
+	e := &Export{Subject: "orders.*.*", Type: Service, ResponseSubject: "replies.$2.$1"}
+	vr := CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	e.ResponseSubject = "replies.$3"
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "$3"), t)
+
+	e.ResponseSubject = "replies.$0"
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+
+	e.ResponseSubject = "replies.*"
+	vr = CreateValidationResults()
+	e.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+
+	vr = CreateValidationResults()
+	(&Export{Subject: "events.*", Type: Stream, ResponseSubject: "replies.$1"}).Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestAuditExportConflicts(t *testing.T) {
+	a := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	b := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	importer := publicKey(createAccountNKey(t), t)
+	other := publicKey(createAccountNKey(t), t)
+
+	a.Exports.Add(&Export{Subject: "billing.*", Type: Service, TokenReq: true, AccountTokenPosition: 2,
+		AllowedAccounts: StringList{importer}})
+	b.Exports.Add(&Export{Subject: "billing.invoices", Type: Service, TokenReq: true,
+		AllowedAccounts: StringList{other}})
+	AssertEquals(0, len(AuditExportConflicts([]*AccountClaims{a, b})), t)
+
+	b.Exports[0].AllowedAccounts.Add(importer)
+	conflicts := AuditExportConflicts([]*AccountClaims{a, b})
+	AssertEquals(1, len(conflicts), t)
+	AssertTrue(strings.Contains(conflicts[0], importer), t)
+	AssertTrue(strings.Contains(conflicts[0], a.Subject) && strings.Contains(conflicts[0], b.Subject), t)
+
+	// public exports and streams don't conflict with token required services
+	b.Exports[0].TokenReq = false
+	b.Exports.Add(&Export{Subject: "billing.events", Type: Stream, TokenReq: true})
+	AssertEquals(0, len(AuditExportConflicts([]*AccountClaims{a, b, nil})), t)
+}
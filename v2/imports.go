@@ -16,9 +16,13 @@
 package jwt
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -52,6 +56,113 @@ func (i *Import) IsStream() bool {
 	return i.Type == Stream
 }
 
+// exportSubject returns the subject as seen by the exporting account. For
+// services that is the To field, if set.
+func (i *Import) exportSubject() Subject {
+	if i.IsService() && i.To != "" {
+		return i.To
+	}
+	return i.Subject
+}
+
+// localSubject returns the subject as seen by the importing account. For streams
+// that is the To field, if set.
+func (i *Import) localSubject() Subject {
+	if i.IsStream() && i.To != "" {
+		return i.To
+	}
+	return i.Subject
+}
+
+// SubjectDrift reports if the import no longer falls within the export, for example
+// after the export subject was narrowed. The description explains the drift.
+func (i *Import) SubjectDrift(export *Export) (bool, string) {
+	if export == nil {
+		return true, fmt.Sprintf("import %q has no export", i.Subject)
+	}
+	if i.Type != export.Type {
+		return true, fmt.Sprintf("import %q of type %s doesn't match export %q of type %s",
+			i.Subject, i.Type, export.Subject, export.Type)
+	}
+	if subj := i.exportSubject(); !subj.IsContainedIn(export.Subject) {
+		return true, fmt.Sprintf("import subject %q is not within export subject %q", subj, export.Subject)
+	}
+	return false, ""
+}
+
+// validateWithExporter checks the import against the export of the exporting account it targets
+func (i *Import) validateWithExporter(importer *AccountClaims, exporter *AccountClaims, vr *ValidationResults) {
+	e := exporter.Exports.MatchingExport(i)
+	if e == nil {
+		if exporter.Exports.matchingExport(i, true) != nil {
+			vr.AddError("import %q matches an inactive export of account %q", i.Subject, exporter.Subject)
+		} else {
+			vr.AddError("import %q is not exported by account %q", i.Subject, exporter.Subject)
+		}
+		return
+	}
+	if len(e.AllowedAccounts) > 0 {
+		if !e.AllowedAccounts.Contains(importer.Subject) {
+			vr.AddError("account %q is not allowed to import %q", importer.Subject, i.Subject)
+		}
+	} else if e.TokenReq && i.Token == "" {
+		vr.AddError("import %q requires an activation token", i.Subject)
+	}
+	for _, tag := range e.RequiredImporterTags {
+		if !importer.Tags.Contains(tag) && !importer.OperatorTags.Contains(tag) {
+			vr.AddError("account %q is missing tag %q required to import %q", importer.Subject, tag, i.Subject)
+		}
+	}
+	if i.IsService() && i.To != "" {
+		i.validateCaptures(e, vr)
+	}
+	if i.Share && e.DisallowShare {
+		vr.AddError("import %q shares information but the export of account %q doesn't allow it",
+			i.Subject, exporter.Subject)
+	} else if i.Share && e.Latency == nil {
+		vr.AddWarning("import %q shares information but the export of account %q doesn't track latency",
+			i.Subject, exporter.Subject)
+	}
+	if i.Token == "" {
+		return
+	}
+	// an undecodable token is reported by Validate
+	act, err := i.DecodeActivation()
+	if err != nil {
+		return
+	}
+	if !act.ImportSubject.IsContainedIn(e.Subject) {
+		vr.AddError("activation for import %q grants %q, exceeding the export subject %q",
+			i.Subject, act.ImportSubject, e.Subject)
+	}
+	if e.MaxTokenExpiry > 0 {
+		if act.Expires == 0 {
+			vr.AddError("activation token for import %q has to expire within %v", i.Subject, e.MaxTokenExpiry)
+		} else if ttl := time.Duration(act.Expires-act.IssuedAt) * time.Second; ttl > e.MaxTokenExpiry {
+			vr.AddError("activation token for import %q is valid for %v, exceeding the maximum of %v",
+				i.Subject, ttl, e.MaxTokenExpiry)
+		}
+	}
+}
+
+// validateCaptures checks that the $N references in the remapped To subject of a service
+// import refer to wildcards of the export subject, and appear at wildcard positions
+func (i *Import) validateCaptures(e *Export, vr *ValidationResults) {
+	exportTokens := strings.Split(string(e.Subject), ".")
+	wildcards := e.Subject.singleWildcards()
+	for _, c := range i.To.captures() {
+		if c.n < 1 || c.n > wildcards {
+			vr.AddError("import %q references capture %s but export %q has %d wildcards",
+				i.Subject, c.token, e.Subject, wildcards)
+			continue
+		}
+		if c.pos >= len(exportTokens) || exportTokens[c.pos] != "*" {
+			vr.AddError("capture %s in import %q is not at a wildcard position of export %q",
+				c.token, i.Subject, e.Subject)
+		}
+	}
+}
+
 // Validate checks if an import is valid for the wrapping account
 func (i *Import) Validate(actPubKey string, vr *ValidationResults) {
 	if i == nil {
@@ -67,39 +178,31 @@ func (i *Import) Validate(actPubKey string, vr *ValidationResults) {
 	}
 
 	i.Subject.Validate(vr)
+	if i.To != "" {
+		i.To.Validate(vr)
+		if i.To.hasEmptyTokens() {
+			vr.AddError("import %q has a malformed to subject %q", i.Subject, i.To)
+		}
+	}
+
+	if i.IsService() && i.To.HasWildCards() {
+		vr.AddError("service import %q can't rewrite requests to the wildcard subject %q, "+
+			"use a concrete subject or token captures ($N)", i.Subject, i.To)
+	}
 
 	if i.Share && !i.IsService() {
 		vr.AddError("sharing information (for latency tracking) is only valid for services: %q", i.Subject)
 	}
+	if i.Share && i.IsService() && i.Account == "" {
+		vr.AddWarning("import %q shares information without an account to share it with", i.Subject)
+	}
 	var act *ActivationClaims
 
 	if i.Token != "" {
-		// Check to see if its an embedded JWT or a URL.
-		if u, err := url.Parse(i.Token); err == nil && u.Scheme != "" {
-			c := &http.Client{Timeout: 5 * time.Second}
-			resp, err := c.Get(u.String())
-			if err != nil {
-				vr.AddWarning("import %s contains an unreachable token URL %q", i.Subject, i.Token)
-			}
-
-			if resp != nil {
-				defer resp.Body.Close()
-				body, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					vr.AddWarning("import %s contains an unreadable token URL %q", i.Subject, i.Token)
-				} else {
-					act, err = DecodeActivationClaims(string(body))
-					if err != nil {
-						vr.AddWarning("import %s contains a URL %q with an invalid activation token", i.Subject, i.Token)
-					}
-				}
-			}
-		} else {
-			var err error
-			act, err = DecodeActivationClaims(i.Token)
-			if err != nil {
-				vr.AddWarning("import %q contains an invalid activation token", i.Subject)
-			}
+		var err error
+		act, err = i.DecodeActivation()
+		if err != nil {
+			vr.AddWarning("import %q contains %v", i.Subject, err)
 		}
 	}
 
@@ -111,10 +214,181 @@ func (i *Import) Validate(actPubKey string, vr *ValidationResults) {
 		if act.ClaimsData.Subject != actPubKey {
 			vr.AddError("activation token doesn't match account it is being included in, %q", i.Subject)
 		}
+		if act.ImportType != i.Type {
+			vr.AddError("activation token type %q doesn't match type %q of import %q", act.ImportType, i.Type, i.Subject)
+		}
 		act.validateWithTimeChecks(vr, false)
 	}
 }
 
+// WouldValidate validates the import as if its token was replaced with the candidate
+// token, for example a renewed activation. Unlike Validate, the expiration and not before
+// times of the candidate activation are checked as well. The import itself is not modified.
+func (i *Import) WouldValidate(newToken string, accountKey string) *ValidationResults {
+	vr := CreateValidationResults()
+	if i == nil {
+		vr.AddError("null import is not allowed")
+		return vr
+	}
+	candidate := *i
+	candidate.Token = newToken
+	candidate.Validate(accountKey, vr)
+	if act, err := candidate.DecodeActivation(); err == nil {
+		act.ClaimsData.Validate(vr)
+	}
+	return vr
+}
+
+// Explode materializes a wildcard import into one import per concrete subject. Each subject
+// has to be matched by the import subject. Token captures ($N) in To are replaced by the
+// token the Nth subject wildcard matched and wildcards in To are replaced, in order, by the
+// tokens the corresponding subject wildcards matched, so remappings are preserved.
+func (i *Import) Explode(concreteSubjects []string) ([]*Import, error) {
+	var imports []*Import
+	for _, c := range concreteSubjects {
+		s := Subject(c)
+		if s == "" || s.HasWildCards() {
+			return nil, fmt.Errorf("subject %q is not a concrete subject", c)
+		}
+		if !s.IsContainedIn(i.Subject) {
+			return nil, fmt.Errorf("subject %q doesn't match import subject %q", c, i.Subject)
+		}
+		ni := *i
+		ni.Subject = s
+		if i.To != "" {
+			ni.To = replaceWildcards(i.To, wildcardValues(s, i.Subject))
+		}
+		imports = append(imports, &ni)
+	}
+	return imports, nil
+}
+
+// wildcardValues returns the tokens of the subject matched by the wildcards of the pattern
+func wildcardValues(s Subject, pattern Subject) []string {
+	tokens := strings.Split(string(s), ".")
+	var values []string
+	for idx, tk := range strings.Split(string(pattern), ".") {
+		switch tk {
+		case "*":
+			values = append(values, tokens[idx])
+		case ">":
+			values = append(values, strings.Join(tokens[idx:], "."))
+		}
+	}
+	return values
+}
+
+// replaceWildcards replaces the captures ($N) of the subject with the Nth value and its
+// wildcards, in order, with the values
+func replaceWildcards(s Subject, values []string) Subject {
+	tokens := strings.Split(string(s), ".")
+	next := values
+	for idx, tk := range tokens {
+		if (tk == "*" || tk == ">") && len(next) > 0 {
+			tokens[idx] = next[0]
+			next = next[1:]
+		}
+	}
+	for _, c := range s.captures() {
+		if c.n >= 1 && c.n <= len(values) {
+			tokens[c.pos] = values[c.n-1]
+		}
+	}
+	return Subject(strings.Join(tokens, "."))
+}
+
+// DecodeActivation returns the activation referenced by the import token, which is either
+// an embedded JWT or a URL the JWT is retrieved from. The signature of the activation is
+// verified, its relationship to the import is not - use Validate for that.
+func (i *Import) DecodeActivation() (*ActivationClaims, error) {
+	if i.Token == "" {
+		return nil, errors.New("no activation token")
+	}
+	// Check to see if its an embedded JWT or a URL.
+	u := i.tokenURL()
+	if u == nil {
+		act, err := DecodeActivationClaims(i.Token)
+		if err != nil {
+			return nil, fmt.Errorf("an invalid activation token: %v", err)
+		}
+		return act, nil
+	}
+	token, err := fetchActivationToken(u)
+	if err != nil {
+		return nil, err
+	}
+	act, err := DecodeActivationClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("a URL %q with an invalid activation token: %v", i.Token, err)
+	}
+	return act, nil
+}
+
+// tokenURL returns the URL of the activation token, or nil if the token is embedded
+func (i *Import) tokenURL() *url.URL {
+	if u, err := url.Parse(i.Token); err == nil && u.Scheme != "" {
+		return u
+	}
+	return nil
+}
+
+// privateNetworks are the IPv4 and IPv6 private address ranges (RFC 1918 and RFC 4193)
+var privateNetworks = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+}
+
+// isPrivateHost returns true for localhost and loopback, private, link-local or unspecified addresses
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchActivationToken(u *url.URL) (string, error) {
+	cache := getActivationCache()
+	if cache != nil {
+		if token, ok := cache.Get(u.String()); ok {
+			return token, nil
+		}
+	}
+	c := &http.Client{Timeout: 5 * time.Second}
+	resp, err := c.Get(u.String())
+	if err != nil {
+		return "", fmt.Errorf("an unreachable token URL %q", u.String())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("a token URL %q responding with status %d", u.String(), resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("an unreadable token URL %q", u.String())
+	}
+	if cache != nil {
+		if ttl, ok := cacheTTL(resp.Header); ok {
+			cache.Set(u.String(), string(body), ttl)
+		}
+	}
+	return string(body), nil
+}
+
 // Imports is a list of import structs
 type Imports []*Import
 
@@ -141,6 +415,47 @@ func (i *Imports) Add(a ...*Import) {
 	*i = append(*i, a...)
 }
 
+// importKey identifies an import independent of its name, token and sharing
+type importKey struct {
+	account string
+	subject Subject
+	to      Subject
+	typ     ExportType
+}
+
+func (i *Import) key() importKey {
+	return importKey{i.Account, i.Subject, i.To, i.Type}
+}
+
+// Diff compares the imports with the desired imports by account, subject, to and type.
+// It returns the desired imports that are missing and the imports that are not desired.
+func (i Imports) Diff(desired Imports) (Imports, Imports) {
+	current := make(map[importKey]bool, len(i))
+	for _, v := range i {
+		if v != nil {
+			current[v.key()] = true
+		}
+	}
+	wanted := make(map[importKey]bool, len(desired))
+	var add Imports
+	for _, v := range desired {
+		if v == nil {
+			continue
+		}
+		wanted[v.key()] = true
+		if !current[v.key()] {
+			add = append(add, v)
+		}
+	}
+	var remove Imports
+	for _, v := range i {
+		if v != nil && !wanted[v.key()] {
+			remove = append(remove, v)
+		}
+	}
+	return add, remove
+}
+
 func (i Imports) Len() int {
 	return len(i)
 }
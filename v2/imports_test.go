@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -50,7 +51,7 @@ func TestImportValidation(t *testing.T) {
 	activation.Expires = time.Now().Add(time.Hour).UTC().Unix()
 
 	activation.ImportSubject = "test"
-	activation.ImportType = Stream
+	activation.ImportType = Service
 	actJWT := encode(activation, ak2, t)
 
 	i.Token = actJWT
@@ -211,7 +212,7 @@ func TestInvalidImportTokenValuesValidation(t *testing.T) {
 	activation.Expires = time.Now().Add(time.Hour).UTC().Unix()
 
 	activation.ImportSubject = "test"
-	activation.ImportType = Stream
+	activation.ImportType = Service
 	actJWT := encode(activation, ak2, t)
 
 	i.Token = actJWT
@@ -501,3 +502,557 @@ func TestImport_Sorting(t *testing.T) {
 		t.Fatal("imports not sorted")
 	}
 }
+
+func TestImportAllowedAccounts(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	other := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "foo", Type: Stream, TokenReq: true})
+
+	imp := &Import{Subject: "foo", Account: exporter.Subject, Type: Stream}
+	importer.Imports.Add(imp)
+	other.Imports.Add(imp)
+
+	// private export without a token
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("private export without a token should be blocking")
+	}
+
+	exporter.Exports[0].AllowedAccounts.Add(importer.Subject)
+	vr = CreateValidationResults()
+	exporter.Exports.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("allowed accounts should be valid: %v", vr.Errors())
+	}
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("allowed importer should not need a token: %v", vr.Errors())
+	}
+
+	vr = CreateValidationResults()
+	other.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("importer not in the allowed accounts should be blocking")
+	}
+}
+
+func TestImportInactiveExport(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "foo", Type: Stream})
+	importer.Imports.Add(&Import{Subject: "foo", Account: exporter.Subject, Type: Stream})
+
+	AssertTrue(exporter.Exports[0].IsActive(), t)
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("active export should authorize the import: %v", vr.Errors())
+	}
+	vr = CreateValidationResults()
+	exporter.ValidateExportsFor([]*AccountClaims{importer}, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	exporter.Exports[0].Inactive = true
+	AssertTrue(exporter.Exports.MatchingExport(importer.Imports[0]) == nil, t)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("inactive export should not authorize the import")
+	}
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "inactive"), t)
+
+	vr = CreateValidationResults()
+	exporter.ValidateExportsFor([]*AccountClaims{importer}, vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(!vr.IsBlocking(false), t)
+
+	// the flag survives encoding
+	token, err := exporter.Encode(createOperatorNKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac, err := DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertTrue(!ac.Exports[0].IsActive(), t)
+}
+
+func TestImportShareDisallowedByExport(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "svc", Type: Service,
+		Latency: &ServiceLatency{Sampling: 100, Results: "latency.svc"}})
+	importer.Imports.Add(&Import{Subject: "svc", Account: exporter.Subject, Type: Service, Share: true})
+
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("sharing should be allowed by default: %v", vr.Errors())
+	}
+
+	exporter.Exports[0].DisallowShare = true
+	vr = CreateValidationResults()
+	exporter.Exports.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("sharing with an export that disallows it should be blocking")
+	}
+
+	importer.Imports[0].Share = false
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	vr = CreateValidationResults()
+	(&Export{Subject: "stream", Type: Stream, DisallowShare: true}).Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestImportNotExported(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "foo.*", Type: Service})
+
+	importer.Imports.Add(&Import{Subject: "bar", To: "foo.bar", Account: exporter.Subject, Type: Service})
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("service import should match the export: %v", vr.Errors())
+	}
+
+	importer.Imports.Add(&Import{Subject: "foo.bar", Account: exporter.Subject, Type: Stream})
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("stream import of a service export should be blocking")
+	}
+}
+
+func TestImportValidationTypeMismatch(t *testing.T) {
+	ak := createAccountNKey(t)
+	ak2 := createAccountNKey(t)
+	akp := publicKey(ak, t)
+	akp2 := publicKey(ak2, t)
+	i := &Import{Subject: "test", Account: akp2, To: "bar", Type: Stream}
+
+	activation := NewActivationClaims(akp)
+	activation.Expires = time.Now().Add(time.Hour).UTC().Unix()
+	activation.ImportSubject = "test"
+	activation.ImportType = Service
+	i.Token = encode(activation, ak2, t)
+
+	vr := CreateValidationResults()
+	i.Validate(akp, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("activation for a service should not validate for a stream import")
+	}
+}
+
+func TestImportDecodeActivation(t *testing.T) {
+	ak := createAccountNKey(t)
+	ak2 := createAccountNKey(t)
+	akp := publicKey(ak, t)
+	akp2 := publicKey(ak2, t)
+	i := &Import{Subject: "test", Account: akp2, To: "bar", Type: Stream}
+
+	if _, err := i.DecodeActivation(); err == nil {
+		t.Fatal("import without a token should fail to decode")
+	}
+
+	activation := NewActivationClaims(akp)
+	activation.ImportSubject = "test"
+	activation.ImportType = Stream
+	actJWT := encode(activation, ak2, t)
+
+	i.Token = actJWT
+	act, err := i.DecodeActivation()
+	AssertNoError(err, t)
+	AssertEquals(akp, act.Subject, t)
+	AssertEquals(akp2, act.Issuer, t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(actJWT))
+	}))
+	defer ts.Close()
+	i.Token = ts.URL
+	act, err = i.DecodeActivation()
+	AssertNoError(err, t)
+	AssertEquals(Subject("test"), act.ImportSubject, t)
+
+	// decoding doesn't check the relationship to the import
+	i.Account = publicKey(createAccountNKey(t), t)
+	_, err = i.DecodeActivation()
+	AssertNoError(err, t)
+
+	i.Token = "bad token"
+	if _, err := i.DecodeActivation(); err == nil {
+		t.Fatal("bad token should fail to decode")
+	}
+}
+
+func TestImportMaxTokenExpiry(t *testing.T) {
+	ikp := createAccountNKey(t)
+	ekp := createAccountNKey(t)
+	importer := NewAccountClaims(publicKey(ikp, t))
+	exporter := NewAccountClaims(publicKey(ekp, t))
+	exporter.Exports.Add(&Export{Subject: "foo", Type: Stream, TokenReq: true, MaxTokenExpiry: time.Hour})
+
+	activation := NewActivationClaims(importer.Subject)
+	activation.ImportSubject = "foo"
+	activation.ImportType = Stream
+	activation.Expires = time.Now().Add(30 * time.Minute).Unix()
+	imp := &Import{Subject: "foo", Account: exporter.Subject, Type: Stream, Token: encode(activation, ekp, t)}
+	importer.Imports.Add(imp)
+
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("activation within the cap should be valid: %v", vr.Errors())
+	}
+
+	activation.Expires = time.Now().Add(2 * time.Hour).Unix()
+	imp.Token = encode(activation, ekp, t)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("activation exceeding the cap should be blocking")
+	}
+
+	activation.Expires = 0
+	imp.Token = encode(activation, ekp, t)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("activation without expiration should be blocking when capped")
+	}
+
+	exporter.Exports[0].MaxTokenExpiry = 0
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("uncapped export should accept any activation: %v", vr.Errors())
+	}
+}
+
+func TestImportMalformedTo(t *testing.T) {
+	akp := publicKey(createAccountNKey(t), t)
+	for to, ok := range map[Subject]bool{
+		"bar":      true,
+		"bar.baz":  true,
+		"bar.*":    true,
+		"bar..baz": false,
+		".bar":     false,
+		"bar.":     false,
+		"bar baz":  false,
+	} {
+		i := &Import{Subject: "foo", Account: akp, To: to, Type: Stream}
+		vr := CreateValidationResults()
+		i.Validate("", vr)
+		if ok != !vr.IsBlocking(false) {
+			t.Fatalf("unexpected validation result for to subject %q: %v", to, vr.Errors())
+		}
+	}
+}
+
+func TestImportExplode(t *testing.T) {
+	apk := publicKey(createAccountNKey(t), t)
+	importer := publicKey(createAccountNKey(t), t)
+	i := &Import{Name: "n", Subject: "foo.*", Account: apk, To: "bar.$1", Type: Service}
+
+	imports, err := i.Explode([]string{"foo.a", "foo.b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(2, len(imports), t)
+	AssertEquals(Subject("foo.a"), imports[0].Subject, t)
+	AssertEquals(Subject("bar.a"), imports[0].To, t)
+	AssertEquals(Subject("foo.b"), imports[1].Subject, t)
+	AssertEquals(Subject("bar.b"), imports[1].To, t)
+	AssertEquals(apk, imports[1].Account, t)
+	AssertEquals(Service, imports[1].Type, t)
+	for _, ni := range imports {
+		vr := CreateValidationResults()
+		ni.Validate(importer, vr)
+		AssertTrue(vr.IsEmpty(), t)
+	}
+	// the original import is unchanged
+	AssertEquals(Subject("foo.*"), i.Subject, t)
+	AssertEquals(Subject("bar.$1"), i.To, t)
+
+	i = &Import{Subject: "foo.*.*", Account: apk, To: "bar.$2.$1", Type: Service}
+	imports, err = i.Explode([]string{"foo.a.b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(Subject("bar.b.a"), imports[0].To, t)
+
+	i = &Import{Subject: "foo.>", Account: apk, To: "baz.>", Type: Stream}
+	imports, err = i.Explode([]string{"foo.a.b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(Subject("baz.a.b"), imports[0].To, t)
+
+	if _, err := i.Explode([]string{"bar.a"}); err == nil {
+		t.Fatal("expected an error for a subject not matching the import")
+	}
+	if _, err := i.Explode([]string{"foo.*"}); err == nil {
+		t.Fatal("expected an error for a wildcard subject")
+	}
+}
+
+func TestImportsDiff(t *testing.T) {
+	apk := publicKey(createAccountNKey(t), t)
+	apk2 := publicKey(createAccountNKey(t), t)
+	current := Imports{
+		&Import{Subject: "foo", Account: apk, Type: Stream},
+		&Import{Subject: "bar", Account: apk, To: "baz", Type: Service},
+		&Import{Subject: "gone", Account: apk, Type: Stream},
+	}
+	desired := Imports{
+		// unchanged, names and tokens don't matter
+		&Import{Name: "renamed", Subject: "foo", Account: apk, Type: Stream},
+		&Import{Subject: "bar", Account: apk, To: "baz", Type: Service},
+		// same subject from another account
+		&Import{Subject: "foo", Account: apk2, Type: Stream},
+		// different to
+		&Import{Subject: "bar", Account: apk, To: "qux", Type: Service},
+	}
+
+	add, remove := current.Diff(desired)
+	AssertEquals(2, len(add), t)
+	AssertEquals(apk2, add[0].Account, t)
+	AssertEquals(Subject("qux"), add[1].To, t)
+	AssertEquals(1, len(remove), t)
+	AssertEquals(Subject("gone"), remove[0].Subject, t)
+
+	add, remove = current.Diff(current)
+	AssertEquals(0, len(add), t)
+	AssertEquals(0, len(remove), t)
+
+	add, remove = Imports{}.Diff(desired)
+	AssertEquals(len(desired), len(add), t)
+	AssertEquals(0, len(remove), t)
+}
+
+func TestImportWouldValidate(t *testing.T) {
+	ak := createAccountNKey(t)
+	akp := publicKey(ak, t)
+	bpk := publicKey(createAccountNKey(t), t)
+
+	activation := NewActivationClaims(bpk)
+	activation.ImportSubject = "foo"
+	activation.ImportType = Stream
+	activation.Expires = time.Now().Add(time.Hour).Unix()
+	current := encode(activation, ak, t)
+
+	i := &Import{Subject: "foo", Account: akp, Token: current, Type: Stream}
+	AssertTrue(i.WouldValidate(current, bpk).IsEmpty(), t)
+
+	activation.Expires = time.Now().Add(24 * time.Hour).Unix()
+	renewed := encode(activation, ak, t)
+	vr := i.WouldValidate(renewed, bpk)
+	if !vr.IsEmpty() {
+		t.Fatalf("renewed token should keep the import valid: %v", vr.Issues)
+	}
+	AssertEquals(current, i.Token, t)
+
+	// issued for another account
+	other := NewActivationClaims(publicKey(createAccountNKey(t), t))
+	other.ImportSubject = "foo"
+	other.ImportType = Stream
+	vr = i.WouldValidate(encode(other, ak, t), bpk)
+	if !vr.IsBlocking(true) {
+		t.Fatal("token for another account should not validate")
+	}
+
+	// already expired
+	activation.Expires = time.Now().Add(-time.Hour).Unix()
+	vr = i.WouldValidate(encode(activation, ak, t), bpk)
+	if !vr.IsBlocking(true) {
+		t.Fatal("expired token should not validate")
+	}
+	AssertEquals(current, i.Token, t)
+}
+
+func TestImportSubjectDrift(t *testing.T) {
+	apk := publicKey(createAccountNKey(t), t)
+	export := &Export{Subject: "orders.>", Type: Stream}
+	i := &Import{Subject: "orders.eu.new", Account: apk, Type: Stream}
+
+	drift, desc := i.SubjectDrift(export)
+	AssertFalse(drift, t)
+	AssertEquals("", desc, t)
+
+	// the export was narrowed
+	export.Subject = "orders.us.>"
+	drift, desc = i.SubjectDrift(export)
+	AssertTrue(drift, t)
+	AssertTrue(strings.Contains(desc, "orders.eu.new") && strings.Contains(desc, "orders.us.>"), t)
+
+	drift, _ = i.SubjectDrift(&Export{Subject: "orders.>", Type: Service})
+	AssertTrue(drift, t)
+	drift, _ = i.SubjectDrift(nil)
+	AssertTrue(drift, t)
+
+	// services are matched on the subject the exporter sees
+	svc := &Import{Subject: "local", To: "svc.a", Account: apk, Type: Service}
+	drift, _ = svc.SubjectDrift(&Export{Subject: "svc.*", Type: Service})
+	AssertFalse(drift, t)
+}
+
+func TestImportRemapCaptures(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "svc.*.*", Type: Service})
+
+	importer.Imports.Add(&Import{Subject: "req.*.*", To: "svc.$2.$1", Account: exporter.Subject, Type: Service})
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("captures should match the export wildcards: %v", vr.Errors())
+	}
+
+	// more captures than the export has wildcards
+	exporter.Exports[0].Subject = "svc.*.>"
+	importer.Imports[0].To = "svc.$1.$2"
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "$2"), t)
+
+	// capture at a literal position of the export
+	exporter.Exports[0].Subject = "svc.*.>"
+	importer.Imports[0].To = "svc.a.$1"
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "wildcard position"), t)
+
+	importer.Imports[0].To = "svc.$0.x"
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestImportRequiredImporterTags(t *testing.T) {
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	e := &Export{Subject: "billing", Type: Service}
+	e.RequiredImporterTags.Add("env:prod", "team:finance")
+	exporter.Exports.Add(e)
+	importer.Imports.Add(&Import{Subject: "billing", Account: exporter.Subject, Type: Service})
+
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+	AssertEquals(2, len(vr.Errors()), t)
+
+	importer.Tags.Add("env:prod")
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "team:finance"), t)
+
+	// operator tags satisfy the requirement too
+	importer.OperatorTags.Add("team:finance")
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestServiceImportWildcardTo(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	exporter := publicKey(createAccountNKey(t), t)
+
+	i := &Import{Subject: "req.*", To: "svc.*", Account: exporter, Type: Service}
+	vr := CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+
+	i.To = "svc.>"
+	vr = CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+
+	i.To = "svc.$1"
+	vr = CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// a capture doesn't make up for a remaining wildcard
+	i.Subject = "req.*.*"
+	i.To = "svc.*.$1"
+	vr = CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertTrue(vr.IsBlocking(false), t)
+	i.Subject = "req.*"
+
+	i.To = "svc.a"
+	vr = CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// streams can import into a wildcard prefix
+	s := &Import{Subject: "events.>", To: "imported.>", Account: exporter, Type: Stream}
+	vr = CreateValidationResults()
+	s.Validate(apk, vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestImportActivationExceedsExport(t *testing.T) {
+	ekp := createAccountNKey(t)
+	exporter := NewAccountClaims(publicKey(ekp, t))
+	exporter.Exports.Add(&Export{Subject: "foo.bar.*", Type: Stream, TokenReq: true, AccountTokenPosition: 3})
+	importer := NewAccountClaims(publicKey(createAccountNKey(t), t))
+
+	activation := NewActivationClaims(importer.Subject)
+	activation.ImportSubject = "foo.>"
+	activation.ImportType = Stream
+	i := &Import{Subject: "foo.bar.x", Account: exporter.Subject, Token: encode(activation, ekp, t), Type: Stream}
+	importer.Imports.Add(i)
+
+	vr := CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertEquals(1, len(vr.Errors()), t)
+	AssertTrue(strings.Contains(vr.Errors()[0].Error(), "foo.>"), t)
+
+	activation.ImportSubject = "foo.bar.*"
+	i.Token = encode(activation, ekp, t)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestImportIncompleteShare(t *testing.T) {
+	apk := publicKey(createAccountNKey(t), t)
+	i := &Import{Subject: "svc", Type: Service, Share: true}
+	vr := CreateValidationResults()
+	i.Validate(apk, vr)
+	AssertFalse(vr.IsBlocking(true), t)
+	AssertEquals(2, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[1], "shares information"), t)
+
+	// the export has to track latency for the shared information to be used
+	importer := NewAccountClaims(apk)
+	exporter := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	exporter.Exports.Add(&Export{Subject: "svc", Type: Service})
+	i.Account = exporter.Subject
+	importer.Imports.Add(i)
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], "latency"), t)
+
+	exporter.Exports[0].Latency = &ServiceLatency{Sampling: Headers, Results: "latency.svc"}
+	vr = CreateValidationResults()
+	importer.ValidateImportsFrom(exporter, vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
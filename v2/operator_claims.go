@@ -19,8 +19,10 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nats-io/nkeys"
 )
@@ -43,24 +45,46 @@ type Operator struct {
 	SystemAccount string `json:"system_account,omitempty"`
 	// Min Server version
 	AssertServerVersion string `json:"assert_server_version,omitempty"`
+	// Min Client version, advisory data for servers to refuse older clients
+	MinClientVersion string `json:"min_client_version,omitempty"`
+	// DeprecatedSigningKeys maps signing keys to the time they are deprecated at,
+	// accounts signed by them should be reissued after that
+	DeprecatedSigningKeys RevocationList `json:"deprecated_signing_keys,omitempty"`
 	GenericFields
 }
 
 func ParseServerVersion(version string) (int, int, int, error) {
+	major, minor, update, err := parseVersion(version)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("asserted server %v", err)
+	}
+	return major, minor, update, nil
+}
+
+// ParseClientVersion parses a version of the form <major>.<minor>.<update>
+func ParseClientVersion(version string) (int, int, int, error) {
+	major, minor, update, err := parseVersion(version)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("min client %v", err)
+	}
+	return major, minor, update, nil
+}
+
+func parseVersion(version string) (int, int, int, error) {
 	if version == "" {
 		return 0, 0, 0, nil
 	}
 	split := strings.Split(version, ".")
 	if len(split) != 3 {
-		return 0, 0, 0, fmt.Errorf("asserted server version must be of the form <major>.<minor>.<update>")
+		return 0, 0, 0, fmt.Errorf("version must be of the form <major>.<minor>.<update>")
 	} else if major, err := strconv.Atoi(split[0]); err != nil {
-		return 0, 0, 0, fmt.Errorf("asserted server version cant parse %s to int", split[0])
+		return 0, 0, 0, fmt.Errorf("version cant parse %s to int", split[0])
 	} else if minor, err := strconv.Atoi(split[1]); err != nil {
-		return 0, 0, 0, fmt.Errorf("asserted server version cant parse %s to int", split[1])
+		return 0, 0, 0, fmt.Errorf("version cant parse %s to int", split[1])
 	} else if update, err := strconv.Atoi(split[2]); err != nil {
-		return 0, 0, 0, fmt.Errorf("asserted server version cant parse %s to int", split[2])
+		return 0, 0, 0, fmt.Errorf("version cant parse %s to int", split[2])
 	} else if major < 0 || minor < 0 || update < 0 {
-		return 0, 0, 0, fmt.Errorf("asserted server version can'b contain negative values: %s", version)
+		return 0, 0, 0, fmt.Errorf("version can'b contain negative values: %s", version)
 	} else {
 		return major, minor, update, nil
 	}
@@ -78,10 +102,20 @@ func (o *Operator) Validate(vr *ValidationResults) {
 		}
 	}
 
+	seen := make(map[string]bool, len(o.SigningKeys))
 	for _, k := range o.SigningKeys {
 		if !nkeys.IsValidPublicOperatorKey(k) {
 			vr.AddError("%s is not an operator public key", k)
 		}
+		if seen[k] {
+			vr.AddWarning("signing key %s is listed more than once", k)
+		}
+		seen[k] = true
+	}
+	for k := range o.DeprecatedSigningKeys {
+		if !nkeys.IsValidPublicOperatorKey(k) {
+			vr.AddError("deprecated signing key %q is not an operator public key", k)
+		}
 	}
 	if o.SystemAccount != "" {
 		if !nkeys.IsValidPublicAccountKey(o.SystemAccount) {
@@ -91,6 +125,9 @@ func (o *Operator) Validate(vr *ValidationResults) {
 	if _, _, _, err := ParseServerVersion(o.AssertServerVersion); err != nil {
 		vr.AddError("assert server version error: %s", err)
 	}
+	if _, _, _, err := ParseClientVersion(o.MinClientVersion); err != nil {
+		vr.AddError("min client version error: %s", err)
+	}
 }
 
 func (o *Operator) validateAccountServerURL() error {
@@ -204,7 +241,7 @@ func DecodeOperatorClaims(token string) (*OperatorClaims, error) {
 	}
 	oc, ok := claims.(*OperatorClaims)
 	if !ok {
-		return nil, errors.New("not operator claim")
+		return nil, newUnexpectedClaimTypeError(OperatorClaim, claims)
 	}
 	return oc, nil
 }
@@ -220,10 +257,22 @@ func (oc *OperatorClaims) Payload() interface{} {
 
 // Validate the contents of the claims
 func (oc *OperatorClaims) Validate(vr *ValidationResults) {
-	oc.ClaimsData.Validate(vr)
+	oc.validate(vr, ValidateOptions{})
+}
+
+func (oc *OperatorClaims) validate(vr *ValidationResults, opts ValidateOptions) {
+	oc.ClaimsData.validate(vr, opts.MaxExpiration)
 	oc.Operator.Validate(vr)
 }
 
+// ValidateWithOptions validates the operator claims like Validate, with the strictness
+// configured by the options
+func (oc *OperatorClaims) ValidateWithOptions(vr *ValidationResults, opts ValidateOptions) {
+	from := len(vr.Issues)
+	oc.validate(vr, opts)
+	opts.applyTo(vr, from)
+}
+
 // ExpectedPrefixes defines the nkey types that can sign operator claims, operator
 func (oc *OperatorClaims) ExpectedPrefixes() []nkeys.PrefixByte {
 	return []nkeys.PrefixByte{nkeys.PrefixByteOperator}
@@ -237,3 +286,135 @@ func (oc *OperatorClaims) Claims() *ClaimsData {
 func (oc *OperatorClaims) updateVersion() {
 	oc.GenericFields.Version = libVersion
 }
+
+// ReferencedAccounts returns the account public keys referenced by the operator, sorted.
+// This is the system account, and account keys listed as signing keys, which Validate
+// rejects but which still reference the account.
+func (oc *OperatorClaims) ReferencedAccounts() []string {
+	var accounts StringList
+	if nkeys.IsValidPublicAccountKey(oc.SystemAccount) {
+		accounts.Add(oc.SystemAccount)
+	}
+	for _, k := range oc.SigningKeys {
+		if nkeys.IsValidPublicAccountKey(k) {
+			accounts.Add(k)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// TrustConfig holds the operator details clients need to bootstrap trust
+type TrustConfig struct {
+	Operator            string     `json:"operator"`
+	SigningKeys         StringList `json:"signing_keys,omitempty"`
+	SystemAccount       string     `json:"system_account,omitempty"`
+	AccountServerURL    string     `json:"account_server_url,omitempty"`
+	OperatorServiceURLs StringList `json:"operator_service_urls,omitempty"`
+}
+
+// TrustConfig returns the trust anchors of the operator suitable for client configuration
+func (oc *OperatorClaims) TrustConfig() TrustConfig {
+	tc := TrustConfig{
+		Operator:         oc.Subject,
+		SystemAccount:    oc.SystemAccount,
+		AccountServerURL: oc.AccountServerURL,
+	}
+	tc.SigningKeys.Add(oc.SigningKeys...)
+	tc.OperatorServiceURLs.Add(oc.OperatorServiceURLs...)
+	return tc
+}
+
+// CheckKeyRoleConflicts reports keys that are used in more than one role across
+// an operator and the accounts it signs, for example an account public key that
+// is also listed as an operator signing key.
+func CheckKeyRoleConflicts(o *OperatorClaims, accounts []*AccountClaims) []string {
+	roles := make(map[string][]string)
+	add := func(k string, role string) {
+		if k == "" {
+			return
+		}
+		// a key listed twice in the same role is a duplicate, not a conflict
+		for _, r := range roles[k] {
+			if r == role {
+				return
+			}
+		}
+		roles[k] = append(roles[k], role)
+	}
+	if o != nil {
+		add(o.Subject, "operator")
+		for _, k := range o.SigningKeys {
+			add(k, "operator signing key")
+		}
+	}
+	for _, a := range accounts {
+		if a == nil {
+			continue
+		}
+		add(a.Subject, fmt.Sprintf("account %s", a.Subject))
+		for k := range a.SigningKeys {
+			add(k, fmt.Sprintf("signing key of account %s", a.Subject))
+		}
+	}
+	var conflicts []string
+	for k, r := range roles {
+		if len(r) > 1 {
+			sort.Strings(r)
+			conflicts = append(conflicts, fmt.Sprintf("key %s is used as %s", k, strings.Join(r, " and ")))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// ValidateOperatorExpiry reports accounts that remain valid after the operator expires,
+// including accounts that never expire. An operator without expiration reports nothing.
+func ValidateOperatorExpiry(o *OperatorClaims, accounts []*AccountClaims) []string {
+	if o == nil || o.Expires == 0 {
+		return nil
+	}
+	var warnings []string
+	for _, a := range accounts {
+		if a == nil {
+			continue
+		}
+		if a.Expires == 0 {
+			warnings = append(warnings, fmt.Sprintf("account %s never expires but operator %s expires at %s",
+				a.Subject, o.Subject, time.Unix(o.Expires, 0).UTC().Format(time.RFC3339)))
+		} else if a.Expires > o.Expires {
+			warnings = append(warnings, fmt.Sprintf("account %s expires at %s after operator %s expires at %s",
+				a.Subject, time.Unix(a.Expires, 0).UTC().Format(time.RFC3339),
+				o.Subject, time.Unix(o.Expires, 0).UTC().Format(time.RFC3339)))
+		}
+	}
+	return warnings
+}
+
+// DeprecateSigningKey records that the signing key should no longer be used after the timestamp
+func (oc *OperatorClaims) DeprecateSigningKey(key string, timestamp time.Time) {
+	if oc.DeprecatedSigningKeys == nil {
+		oc.DeprecatedSigningKeys = RevocationList{}
+	}
+	oc.DeprecatedSigningKeys[key] = timestamp.Unix()
+}
+
+// ValidateSigningKeyFreshness reports accounts that are signed by a signing key the operator
+// has deprecated. Such accounts remain valid but should be reissued with a current key.
+func ValidateSigningKeyFreshness(o *OperatorClaims, accounts []*AccountClaims) []string {
+	if o == nil || len(o.DeprecatedSigningKeys) == 0 {
+		return nil
+	}
+	now := Now().Unix()
+	var warnings []string
+	for _, a := range accounts {
+		if a == nil {
+			continue
+		}
+		if ts, ok := o.DeprecatedSigningKeys[a.Issuer]; ok && ts <= now {
+			warnings = append(warnings, fmt.Sprintf("account %s is signed by signing key %s deprecated at %s",
+				a.Subject, a.Issuer, time.Unix(ts, 0).UTC().Format(time.RFC3339)))
+		}
+	}
+	return warnings
+}
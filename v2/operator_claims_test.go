@@ -16,7 +16,10 @@
 package jwt
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -459,3 +462,184 @@ func TestTags(t *testing.T) {
 	AssertTrue(oc.GenericFields.Tags.Contains("two"), t)
 	AssertTrue(oc.GenericFields.Tags.Contains("three"), t)
 }
+
+func TestCheckKeyRoleConflicts(t *testing.T) {
+	okp := createOperatorNKey(t)
+	apk := publicKey(createAccountNKey(t), t)
+	apk2 := publicKey(createAccountNKey(t), t)
+
+	oc := NewOperatorClaims(publicKey(okp, t))
+	oc.SigningKeys.Add(publicKey(createOperatorNKey(t), t))
+	ac := NewAccountClaims(apk)
+	ac2 := NewAccountClaims(apk2)
+	ac2.SigningKeys.Add(publicKey(createAccountNKey(t), t))
+
+	if c := CheckKeyRoleConflicts(oc, []*AccountClaims{ac, ac2}); len(c) != 0 {
+		t.Fatalf("expected no conflicts: %v", c)
+	}
+
+	// a signing key listed twice is a duplicate, not a role conflict
+	dup := NewOperatorClaims(oc.Subject)
+	dup.SigningKeys = StringList{oc.SigningKeys[0], oc.SigningKeys[0]}
+	if c := CheckKeyRoleConflicts(dup, []*AccountClaims{ac, ac2}); len(c) != 0 {
+		t.Fatalf("expected no conflicts for a duplicated signing key: %v", c)
+	}
+
+	// copy-paste mistake - an account identity ends up as an operator signing key
+	oc.SigningKeys.Add(apk)
+	c := CheckKeyRoleConflicts(oc, []*AccountClaims{ac, ac2})
+	if len(c) != 1 {
+		t.Fatalf("expected one conflict: %v", c)
+	}
+	AssertTrue(strings.Contains(c[0], apk), t)
+	AssertTrue(strings.Contains(c[0], "operator signing key"), t)
+
+	// the same signing key shared by two accounts is a conflict as well
+	ac.SigningKeys.Add(ac2.SigningKeys.Keys()...)
+	AssertEquals(2, len(CheckKeyRoleConflicts(oc, []*AccountClaims{ac, ac2})), t)
+}
+
+func TestOperatorTrustConfig(t *testing.T) {
+	okp := createOperatorNKey(t)
+	sk := publicKey(createOperatorNKey(t), t)
+	sys := publicKey(createAccountNKey(t), t)
+	oc := NewOperatorClaims(publicKey(okp, t))
+	oc.SigningKeys.Add(sk)
+	oc.SystemAccount = sys
+	oc.AccountServerURL = "https://account.example.com/jwt/v1"
+	oc.OperatorServiceURLs.Add("nats://nats.example.com:4222")
+
+	tc := oc.TrustConfig()
+	AssertEquals(oc.Subject, tc.Operator, t)
+	AssertEquals(sys, tc.SystemAccount, t)
+	AssertEquals(oc.AccountServerURL, tc.AccountServerURL, t)
+	AssertTrue(tc.SigningKeys.Contains(sk), t)
+	AssertTrue(tc.OperatorServiceURLs.Contains("nats://nats.example.com:4222"), t)
+
+	// the config is independent of the claim
+	oc.SigningKeys.Remove(sk)
+	AssertTrue(tc.SigningKeys.Contains(sk), t)
+
+	d, err := json.Marshal(tc)
+	AssertNoError(err, t)
+	var tc2 TrustConfig
+	AssertNoError(json.Unmarshal(d, &tc2), t)
+	AssertEquals(tc.Operator, tc2.Operator, t)
+	AssertEquals(1, len(tc2.SigningKeys), t)
+}
+
+func Test_MinClientVersion(t *testing.T) {
+	kp := createOperatorNKey(t)
+	oc := NewOperatorClaims(publicKey(kp, t))
+	oc.MinClientVersion = "1.11.0"
+	oc, err := DecodeOperatorClaims(encode(oc, kp, t))
+	AssertNoError(err, t)
+	AssertEquals("1.11.0", oc.MinClientVersion, t)
+	vr := CreateValidationResults()
+	oc.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	for _, v := range []string{"1.11", "a.b.c", "1.-1.0"} {
+		oc.MinClientVersion = v
+		vr = CreateValidationResults()
+		oc.Validate(vr)
+		if !vr.IsBlocking(false) {
+			t.Fatalf("expected %q to be invalid", v)
+		}
+	}
+
+	_, _, _, err = ParseServerVersion("1.0")
+	AssertEquals("asserted server version must be of the form <major>.<minor>.<update>", err.Error(), t)
+}
+
+func TestValidateOperatorExpiry(t *testing.T) {
+	now := time.Now()
+	oc := NewOperatorClaims(publicKey(createOperatorNKey(t), t))
+	ac := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	ac2 := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	ac2.Expires = now.Add(time.Hour).Unix()
+
+	// an operator that never expires can't be outlived
+	AssertEquals(0, len(ValidateOperatorExpiry(oc, []*AccountClaims{ac, ac2})), t)
+
+	oc.Expires = now.Add(2 * time.Hour).Unix()
+	w := ValidateOperatorExpiry(oc, []*AccountClaims{ac, ac2})
+	AssertEquals(1, len(w), t)
+	AssertTrue(strings.Contains(w[0], ac.Subject), t)
+
+	ac.Expires = now.Add(time.Hour).Unix()
+	ac2.Expires = now.Add(3 * time.Hour).Unix()
+	w = ValidateOperatorExpiry(oc, []*AccountClaims{ac, ac2})
+	AssertEquals(1, len(w), t)
+	AssertTrue(strings.Contains(w[0], ac2.Subject), t)
+}
+
+func TestOperatorDuplicateSigningKey(t *testing.T) {
+	sk := publicKey(createOperatorNKey(t), t)
+	oc := NewOperatorClaims(publicKey(createOperatorNKey(t), t))
+	oc.SigningKeys.Add(sk, sk)
+	AssertEquals(1, len(oc.SigningKeys), t)
+
+	vr := CreateValidationResults()
+	oc.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// lists assigned directly or decoded from a token aren't deduplicated
+	oc.SigningKeys = StringList{sk, sk}
+	vr = CreateValidationResults()
+	oc.Validate(vr)
+	AssertEquals(1, len(vr.Issues), t)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertTrue(strings.Contains(vr.Warnings()[0], sk), t)
+}
+
+func TestValidateSigningKeyFreshness(t *testing.T) {
+	okp := createOperatorNKey(t)
+	oldKP := createOperatorNKey(t)
+	newKP := createOperatorNKey(t)
+	oc := NewOperatorClaims(publicKey(okp, t))
+	oc.SigningKeys.Add(publicKey(oldKP, t), publicKey(newKP, t))
+
+	a1, err := DecodeAccountClaims(encode(NewAccountClaims(publicKey(createAccountNKey(t), t)), oldKP, t))
+	AssertNoError(err, t)
+	a2, err := DecodeAccountClaims(encode(NewAccountClaims(publicKey(createAccountNKey(t), t)), newKP, t))
+	AssertNoError(err, t)
+	accounts := []*AccountClaims{a1, a2}
+
+	AssertEquals(0, len(ValidateSigningKeyFreshness(oc, accounts)), t)
+
+	// a deprecation in the future doesn't apply yet
+	oc.DeprecateSigningKey(publicKey(oldKP, t), time.Now().Add(time.Hour))
+	AssertEquals(0, len(ValidateSigningKeyFreshness(oc, accounts)), t)
+
+	oc.DeprecateSigningKey(publicKey(oldKP, t), time.Now().Add(-time.Hour))
+	w := ValidateSigningKeyFreshness(oc, accounts)
+	AssertEquals(1, len(w), t)
+	AssertTrue(strings.Contains(w[0], a1.Subject), t)
+	AssertTrue(strings.Contains(w[0], publicKey(oldKP, t)), t)
+
+	vr := CreateValidationResults()
+	oc.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	oc.DeprecateSigningKey(a1.Subject, time.Now())
+	vr = CreateValidationResults()
+	oc.Validate(vr)
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestOperatorReferencedAccounts(t *testing.T) {
+	oc := NewOperatorClaims(publicKey(createOperatorNKey(t), t))
+	AssertEquals(0, len(oc.ReferencedAccounts()), t)
+
+	sys := publicKey(createAccountNKey(t), t)
+	oc.SystemAccount = sys
+	oc.SigningKeys.Add(publicKey(createOperatorNKey(t), t))
+	AssertEquals(sys, strings.Join(oc.ReferencedAccounts(), ","), t)
+
+	// an account key misused as signing key is referenced too
+	ak := publicKey(createAccountNKey(t), t)
+	oc.SigningKeys.Add(ak, sys)
+	expected := []string{sys, ak}
+	sort.Strings(expected)
+	AssertEquals(strings.Join(expected, ","), strings.Join(oc.ReferencedAccounts(), ","), t)
+}
@@ -16,6 +16,7 @@
 package jwt
 
 import (
+	"sort"
 	"time"
 )
 
@@ -60,6 +61,22 @@ func (r RevocationList) MaybeCompact() []RevocationEntry {
 	return deleted
 }
 
+// Sorted returns the revocations ordered by public key, with the jwt.All entry last.
+// Encoded JWTs are already ordered, the JSON encoding sorts the keys of the map.
+func (r RevocationList) Sorted() []RevocationEntry {
+	entries := make([]RevocationEntry, 0, len(r))
+	for k, ts := range r {
+		entries = append(entries, RevocationEntry{PublicKey: k, TimeStamp: ts})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].PublicKey == All || entries[j].PublicKey == All {
+			return entries[j].PublicKey == All && entries[i].PublicKey != All
+		}
+		return entries[i].PublicKey < entries[j].PublicKey
+	})
+	return entries
+}
+
 // ClearRevocation removes any revocation for the public key
 func (r RevocationList) ClearRevocation(pubKey string) {
 	delete(r, pubKey)
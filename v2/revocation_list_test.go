@@ -52,3 +52,28 @@ func TestRevocationCompact(t *testing.T) {
 		t.Error("didn't revoke expected entries")
 	}
 }
+
+func TestRevocationSorted(t *testing.T) {
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, publicKey(createUserNKey(t), t))
+	}
+	r := make(RevocationList)
+	r.Revoke(All, time.Unix(100, 0))
+	for i, k := range keys {
+		r.Revoke(k, time.Unix(int64(i), 0))
+	}
+	sort.Strings(keys)
+
+	for n := 0; n < 10; n++ {
+		sorted := r.Sorted()
+		AssertEquals(len(keys)+1, len(sorted), t)
+		for i, k := range keys {
+			AssertEquals(k, sorted[i].PublicKey, t)
+			AssertEquals(r[k], sorted[i].TimeStamp, t)
+		}
+		AssertEquals(All, sorted[len(keys)].PublicKey, t)
+		AssertEquals(int64(100), sorted[len(keys)].TimeStamp, t)
+	}
+	AssertEquals(0, len(RevocationList{}.Sorted()), t)
+}
@@ -87,6 +87,34 @@ func (us UserScope) Validate(vr *ValidationResults) {
 	if !nkeys.IsValidPublicAccountKey(us.Key) {
 		vr.AddError("%s is not an account public key", us.Key)
 	}
+	// users signed by the key inherit the template, report its issues against the key
+	tvr := CreateValidationResults()
+	us.validateTemplate(tvr)
+	for _, vi := range tvr.Issues {
+		vr.Add(&ValidationIssue{
+			Description: fmt.Sprintf("template of scoped signing key %s: %s", us.Key, vi.Description),
+			Blocking:    vi.Blocking,
+			TimeCheck:   vi.TimeCheck,
+		})
+	}
+}
+
+func (us UserScope) validateTemplate(vr *ValidationResults) {
+	t := us.Template
+	// sub subjects, which may name a queue, are checked by the permissions
+	t.Permissions.Validate(vr)
+	t.Pub.Validate(vr)
+	for _, subj := range append(t.Pub.Allow, t.Pub.Deny...) {
+		if Subject(subj).hasEmptyTokens() {
+			vr.AddError("subject %q is malformed", subj)
+		}
+	}
+	t.Limits.Validate(vr)
+	for _, ct := range t.AllowedConnectionTypes {
+		if !isKnownConnectionType(ct) {
+			vr.AddWarning("unknown allowed connection type %q", ct)
+		}
+	}
 }
 
 func (us UserScope) ValidateScopedSigner(c Claims) error {
@@ -249,3 +249,30 @@ func TestGetKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestScopedSigningKeyTemplateValidation(t *testing.T) {
+	ac := NewAccountClaims(publicKey(createAccountNKey(t), t))
+	good := NewUserScope()
+	good.Key = publicKey(createAccountNKey(t), t)
+	good.Template.Pub.Allow.Add("dashboard.>")
+	bad := NewUserScope()
+	bad.Key = publicKey(createAccountNKey(t), t)
+	bad.Template.Pub.Allow.Add("dashboard..>")
+	ac.SigningKeys.AddScopedSigner(good)
+
+	vr := CreateValidationResults()
+	ac.Validate(vr)
+	if !vr.IsEmpty() {
+		t.Fatalf("valid template should pass: %v", vr.Errors())
+	}
+
+	ac.SigningKeys.AddScopedSigner(bad)
+	vr = CreateValidationResults()
+	ac.Validate(vr)
+	errs := vr.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected one error for the malformed template: %v", errs)
+	}
+	AssertTrue(strings.Contains(errs[0].Error(), bad.Key), t)
+	AssertTrue(strings.Contains(errs[0].Error(), "dashboard..>"), t)
+}
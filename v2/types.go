@@ -21,6 +21,8 @@ import (
 	"net"
 	"net/url"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -62,6 +64,9 @@ const (
 	Service
 )
 
+// ImportType is the type of an import, imports share their types with exports
+type ImportType = ExportType
+
 func (t ExportType) String() string {
 	switch t {
 	case Stream:
@@ -72,6 +77,24 @@ func (t ExportType) String() string {
 	return "unknown"
 }
 
+// ParseExportType parses the string form of an export type, ignoring case.
+// Unknown is returned along with an error for unrecognized values.
+func ParseExportType(s string) (ExportType, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "stream":
+		return Stream, nil
+	case "service":
+		return Service, nil
+	}
+	return Unknown, fmt.Errorf("unknown export type %q", s)
+}
+
+// ParseImportType parses the string form of an import type, ignoring case.
+// Unknown is returned along with an error for unrecognized values.
+func ParseImportType(s string) (ImportType, error) {
+	return ParseExportType(s)
+}
+
 // MarshalJSON marshals the enum as a quoted json string
 func (t *ExportType) MarshalJSON() ([]byte, error) {
 	switch *t {
@@ -115,6 +138,48 @@ func (s Subject) Validate(vr *ValidationResults) {
 	}
 }
 
+// hasEmptyTokens returns true if the subject has a leading, trailing or double dot
+func (s Subject) hasEmptyTokens() bool {
+	for _, tk := range strings.Split(string(s), ".") {
+		if tk == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// capture is a token referencing the subject matched by the Nth * wildcard ($N)
+type capture struct {
+	pos   int
+	n     int
+	token string
+}
+
+// captures returns the tokens of the subject that reference captured wildcards ($N)
+func (s Subject) captures() []capture {
+	var c []capture
+	for pos, tk := range strings.Split(string(s), ".") {
+		if !strings.HasPrefix(tk, "$") {
+			continue
+		}
+		if n, err := strconv.Atoi(tk[1:]); err == nil {
+			c = append(c, capture{pos: pos, n: n, token: tk})
+		}
+	}
+	return c
+}
+
+// singleWildcards returns the number of * tokens of the subject, which captures refer to
+func (s Subject) singleWildcards() int {
+	n := 0
+	for _, tk := range strings.Split(string(s), ".") {
+		if tk == "*" {
+			n++
+		}
+	}
+	return n
+}
+
 // HasWildCards is used to check if a subject contains a > or *
 func (s Subject) HasWildCards() bool {
 	v := string(s)
@@ -128,30 +193,59 @@ func (s Subject) HasWildCards() bool {
 
 // IsContainedIn does a simple test to see if the subject is contained in another subject
 func (s Subject) IsContainedIn(other Subject) bool {
-	otherArray := strings.Split(string(other), ".")
-	myArray := strings.Split(string(s), ".")
+	return SubjectMatches(string(other), string(s))
+}
 
-	if len(myArray) > len(otherArray) && otherArray[len(otherArray)-1] != ">" {
-		return false
+// SubjectMatches returns true if the subject is matched by the pattern, using NATS wildcard
+// rules: "*" matches a single token and a trailing ">" matches one or more tokens. Wildcards
+// in the subject are treated as tokens, "*" is matched by "*" or ">" and ">" only by ">",
+// so a pattern matches a wildcard subject only if it matches everything the subject does.
+func SubjectMatches(pattern, subject string) bool {
+	if pattern == subject {
+		return true
 	}
-
-	if len(myArray) < len(otherArray) {
-		return false
+	for {
+		ptk, prest, pmore := nextToken(pattern)
+		stk, srest, smore := nextToken(subject)
+		switch {
+		case ptk == ">" && !pmore:
+			return stk != ""
+		case ptk == "*":
+			if stk == ">" || stk == "" {
+				return false
+			}
+		case ptk != stk:
+			return false
+		}
+		if !pmore || !smore {
+			return pmore == smore
+		}
+		pattern, subject = prest, srest
 	}
+}
 
-	for ind, tok := range otherArray {
-		myTok := myArray[ind]
+// nextToken splits the first token off the subject and reports if more tokens follow
+func nextToken(subject string) (string, string, bool) {
+	if i := strings.IndexByte(subject, '.'); i >= 0 {
+		return subject[:i], subject[i+1:], true
+	}
+	return subject, "", false
+}
 
-		if ind == len(otherArray)-1 && tok == ">" {
+// overlaps returns true if at least one concrete subject matches both subjects
+func (s Subject) overlaps(other Subject) bool {
+	myArray := strings.Split(string(s), ".")
+	otherArray := strings.Split(string(other), ".")
+	for ind := 0; ind < len(myArray) && ind < len(otherArray); ind++ {
+		myTok, tok := myArray[ind], otherArray[ind]
+		if myTok == ">" || tok == ">" {
 			return true
 		}
-
-		if tok != myTok && tok != "*" {
+		if myTok != tok && myTok != "*" && tok != "*" {
 			return false
 		}
 	}
-
-	return true
+	return len(myArray) == len(otherArray)
 }
 
 // TimeRange is used to represent a start and end time
@@ -164,11 +258,13 @@ type TimeRange struct {
 func (tr *TimeRange) Validate(vr *ValidationResults) {
 	format := "15:04:05"
 
+	var start, end time.Time
+	var startErr, endErr error
 	if tr.Start == "" {
 		vr.AddError("time ranges start must contain a start")
 	} else {
-		_, err := time.Parse(format, tr.Start)
-		if err != nil {
+		start, startErr = time.Parse(format, tr.Start)
+		if startErr != nil {
 			vr.AddError("start in time range is invalid %q", tr.Start)
 		}
 	}
@@ -176,11 +272,36 @@ func (tr *TimeRange) Validate(vr *ValidationResults) {
 	if tr.End == "" {
 		vr.AddError("time ranges end must contain an end")
 	} else {
-		_, err := time.Parse(format, tr.End)
-		if err != nil {
+		end, endErr = time.Parse(format, tr.End)
+		if endErr != nil {
 			vr.AddError("end in time range is invalid %q", tr.End)
 		}
 	}
+
+	if tr.Start != "" && tr.End != "" && startErr == nil && endErr == nil && start.After(end) {
+		vr.AddWarning("time range %s-%s ends before it starts and is interpreted as wrapping past midnight",
+			tr.Start, tr.End)
+	}
+}
+
+// contains returns true if the time of day of t is within the range. Ranges ending
+// before they start wrap past midnight.
+func (tr *TimeRange) contains(t time.Time) bool {
+	format := "15:04:05"
+	start, err := time.Parse(format, tr.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(format, tr.End)
+	if err != nil {
+		return false
+	}
+	h, m, s := t.Clock()
+	tod := time.Date(start.Year(), start.Month(), start.Day(), h, m, s, 0, time.UTC)
+	if start.After(end) {
+		return !tod.Before(start) || tod.Before(end)
+	}
+	return !tod.Before(start) && tod.Before(end)
 }
 
 // Src is a comma separated list of CIDR specifications
@@ -252,6 +373,106 @@ func (p *Permission) Validate(vr *ValidationResults) {
 	}
 }
 
+// effective returns the sorted allow and deny subjects without entries shadowed by
+// broader subjects of the same list. Allowed subjects that are denied are dropped.
+func (p *Permission) effective() ([]string, []string) {
+	denied := compactSubjects(p.Deny)
+	var allowed []string
+	for _, a := range compactSubjects(p.Allow) {
+		isDenied := false
+		for _, d := range denied {
+			if Subject(a).IsContainedIn(Subject(d)) {
+				isDenied = true
+				break
+			}
+		}
+		if !isDenied {
+			allowed = append(allowed, a)
+		}
+	}
+	return allowed, denied
+}
+
+// Compact removes subjects shadowed by broader subjects of the same allow or deny list.
+// Unlike effective, allowed subjects that are also denied are kept, as dropping them
+// could leave an empty allow list, which allows everything.
+func (p *Permission) Compact() {
+	if len(p.Allow) > 0 {
+		p.Allow = compactSubjects(p.Allow)
+	}
+	if len(p.Deny) > 0 {
+		p.Deny = compactSubjects(p.Deny)
+	}
+}
+
+// compactSubjects returns the sorted unique subjects not contained in another subject of the list
+func compactSubjects(subjects []string) []string {
+	var compacted []string
+	for i, s := range subjects {
+		shadowed := false
+		for j, o := range subjects {
+			if i == j {
+				continue
+			}
+			// of two identical subjects keep the first
+			if s == o && i < j {
+				continue
+			}
+			if Subject(s).IsContainedIn(Subject(o)) {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			compacted = append(compacted, s)
+		}
+	}
+	sort.Strings(compacted)
+	return compacted
+}
+
+// minimalAllowGroupSize is the number of sibling subjects MinimalAllow collapses into a wildcard
+const minimalAllowGroupSize = 3
+
+// MinimalAllow returns a short allow list covering the subjects. Subjects that only differ
+// in their last token are replaced with a * wildcard in that position, when at least
+// three of them are present. This grants the group's other siblings as well, but
+// never subjects with a different prefix or token count. Subjects covered by other
+// subjects in the list are dropped. The result is sorted.
+func MinimalAllow(subjects []string) []string {
+	groups := make(map[string]StringList)
+	var order []string
+	for _, s := range subjects {
+		idx := strings.LastIndex(s, ".")
+		if s == "" || idx < 0 || Subject(s).HasWildCards() {
+			continue
+		}
+		prefix := s[:idx+1]
+		if _, ok := groups[prefix]; !ok {
+			order = append(order, prefix)
+		}
+		l := groups[prefix]
+		l.Add(s)
+		groups[prefix] = l
+	}
+	var collapsed []string
+	for _, s := range subjects {
+		idx := strings.LastIndex(s, ".")
+		if s == "" {
+			continue
+		}
+		if idx < 0 || Subject(s).HasWildCards() || len(groups[s[:idx+1]]) < minimalAllowGroupSize {
+			collapsed = append(collapsed, s)
+		}
+	}
+	for _, prefix := range order {
+		if len(groups[prefix]) >= minimalAllowGroupSize {
+			collapsed = append(collapsed, prefix+"*")
+		}
+	}
+	return compactSubjects(collapsed)
+}
+
 // ResponsePermission can be used to allow responses to any reply subject
 // that is received on a valid subscription.
 type ResponsePermission struct {
@@ -271,10 +492,139 @@ type Permissions struct {
 	Resp *ResponsePermission `json:"resp,omitempty"`
 }
 
+// DenyAllPermissions returns permissions denying publish and subscribe on all subjects
+func DenyAllPermissions() *Permissions {
+	return AllowOnly(nil, nil)
+}
+
+// AllowOnly returns permissions that only allow publishing to pub and subscribing to sub.
+// A non empty allow list already excludes all other subjects - as deny rules take
+// precedence over allow rules, a side with allowed subjects must not deny ">".
+// A side without any allowed subjects denies ">".
+func AllowOnly(pub []string, sub []string) *Permissions {
+	var p Permissions
+	for _, v := range []struct {
+		perm     *Permission
+		subjects []string
+	}{{&p.Pub, pub}, {&p.Sub, sub}} {
+		v.perm.Allow.Add(v.subjects...)
+		if len(v.perm.Allow) == 0 {
+			v.perm.Deny.Add(">")
+		}
+	}
+	return &p
+}
+
+// inboxPrefix covers the default reply subjects of request-reply
+const inboxPrefix = Subject("_INBOX.>")
+
+// MakeSubscriberOnly removes the permissions to act as a service: the response permission
+// is cleared and publish allow subjects are dropped. Allowed subjects within _INBOX.> are
+// kept, so the user can still make requests with the default reply subjects. As an empty
+// allow list would allow publishing everywhere, ">" is denied when no subject is left.
+// Publish deny subjects are kept. The resulting permissions are validated, kept inbox
+// subjects that are denied are reported as warnings.
+func (p *Permissions) MakeSubscriberOnly() *ValidationResults {
+	p.Resp = nil
+	var inbox StringList
+	for _, s := range p.Pub.Allow {
+		if Subject(s).IsContainedIn(inboxPrefix) {
+			inbox.Add(s)
+		}
+	}
+	p.Pub.Allow = inbox
+	if len(p.Pub.Allow) == 0 {
+		p.Pub.Deny.Add(">")
+	}
+	vr := CreateValidationResults()
+	p.Validate(vr)
+	p.Pub.Validate(vr)
+	for _, s := range p.Pub.Allow {
+		for _, d := range p.Pub.Deny {
+			if Subject(s).IsContainedIn(Subject(d)) {
+				vr.AddWarning("publish subject %q is kept for requests but denied by %q", s, d)
+				break
+			}
+		}
+	}
+	return vr
+}
+
+// PolicyText describes the permissions in a human readable form, for example
+// "May publish to: foo.>; May subscribe to: any subject except bar; Responses limited to 1 msgs for 1s"
+func (p *Permissions) PolicyText() string {
+	describe := func(p Permission) string {
+		allowed := "any subject"
+		if len(p.Allow) > 0 {
+			allowed = strings.Join(p.Allow, ", ")
+		}
+		if len(p.Deny) > 0 {
+			allowed = fmt.Sprintf("%s except %s", allowed, strings.Join(p.Deny, ", "))
+		}
+		return allowed
+	}
+	parts := []string{
+		"May publish to: " + describe(p.Pub),
+		"May subscribe to: " + describe(p.Sub),
+	}
+	if p.Resp != nil {
+		parts = append(parts, fmt.Sprintf("Responses limited to %d msgs for %v", p.Resp.MaxMsgs, p.Resp.Expires))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// EffectivePublish returns the allowed and denied publish subjects, sorted and without
+// redundant entries. An empty allow list means all subjects not denied are allowed.
+func (p *Permissions) EffectivePublish() ([]string, []string) {
+	return p.Pub.effective()
+}
+
+// EffectiveSubscribe returns the allowed and denied subscribe subjects, sorted and without
+// redundant entries. An empty allow list means all subjects not denied are allowed.
+func (p *Permissions) EffectiveSubscribe() ([]string, []string) {
+	return p.Sub.effective()
+}
+
+// Compact removes redundant publish and subscribe subjects to reduce the token size,
+// the effective permissions don't change.
+func (p *Permissions) Compact() {
+	p.Pub.Compact()
+	p.Sub.Compact()
+}
+
+// ParseSubPermission splits a subscribe permission of the form "<subject> [<queue>]"
+// into its subject and optional queue, both of which have to be well formed.
+func ParseSubPermission(s string) (subject, queue string, err error) {
+	parts := strings.Split(s, " ")
+	if len(parts) > 2 {
+		return "", "", fmt.Errorf("sub permission %q has more than a subject and a queue", s)
+	}
+	subject = parts[0]
+	if subject == "" || Subject(subject).hasEmptyTokens() {
+		return "", "", fmt.Errorf("sub permission %q has a malformed subject", s)
+	}
+	if len(parts) == 2 {
+		queue = parts[1]
+		if queue == "" || Subject(queue).hasEmptyTokens() {
+			return "", "", fmt.Errorf("sub permission %q has a malformed queue", s)
+		}
+	}
+	return subject, queue, nil
+}
+
 // Validate the pub and sub fields in the permissions list
 func (p *Permissions) Validate(vr *ValidationResults) {
+	for _, subj := range append(p.Sub.Allow, p.Sub.Deny...) {
+		if _, _, err := ParseSubPermission(subj); err != nil {
+			vr.AddError(err.Error())
+		}
+	}
 	if p.Resp != nil {
 		p.Resp.Validate(vr)
+		if len(p.Sub.Allow) == 0 {
+			vr.AddWarning("response permissions only apply to requests received on subscriptions, " +
+				"consider allowing the subjects requests are subscribed to")
+		}
 	}
 }
 
@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestVersion(t *testing.T) {
@@ -110,6 +111,21 @@ func TestTimeRangeValidation(t *testing.T) {
 	}
 }
 
+func TestTimeRangeOvernight(t *testing.T) {
+	tr := TimeRange{Start: "22:00:00", End: "06:00:00"}
+	vr := CreateValidationResults()
+	tr.Validate(vr)
+	if len(vr.Issues) != 1 || vr.IsBlocking(true) {
+		t.Fatalf("overnight range should produce a single warning: %v", vr.Issues)
+	}
+	AssertTrue(strings.Contains(vr.Warnings()[0], "midnight"), t)
+
+	tr = TimeRange{Start: "06:00:00", End: "22:00:00"}
+	vr = CreateValidationResults()
+	tr.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
 func TestTagList(t *testing.T) {
 	tags := TagList{}
 
@@ -296,3 +312,294 @@ func TestInvalidInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestParseExportType(t *testing.T) {
+	for _, et := range []ExportType{Stream, Service} {
+		v, err := ParseExportType(et.String())
+		AssertNoError(err, t)
+		AssertEquals(et, v, t)
+		v, err = ParseImportType(strings.ToUpper(et.String()))
+		AssertNoError(err, t)
+		AssertEquals(et, v, t)
+	}
+	for _, s := range []string{"", "unknown", "streams"} {
+		v, err := ParseExportType(s)
+		if err == nil {
+			t.Fatalf("expected %q to fail parsing", s)
+		}
+		AssertEquals(Unknown, v, t)
+		_, err = ParseImportType(s)
+		if err == nil {
+			t.Fatalf("expected %q to fail parsing", s)
+		}
+	}
+	AssertEquals("unknown", Unknown.String(), t)
+}
+
+// permits mirrors the server's evaluation: allow (if set) has to match and deny must not
+func permits(p Permission, subject string) bool {
+	allowed := len(p.Allow) == 0
+	for _, a := range p.Allow {
+		if Subject(subject).IsContainedIn(Subject(a)) {
+			allowed = true
+		}
+	}
+	for _, d := range p.Deny {
+		if Subject(subject).IsContainedIn(Subject(d)) {
+			return false
+		}
+	}
+	return allowed
+}
+
+func TestPermissionPresets(t *testing.T) {
+	p := DenyAllPermissions()
+	vr := CreateValidationResults()
+	p.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	for _, s := range []string{"foo", "foo.bar", "$SYS.x", "_INBOX.abc"} {
+		AssertFalse(permits(p.Pub, s), t)
+		AssertFalse(permits(p.Sub, s), t)
+	}
+
+	p = AllowOnly([]string{"req.>"}, []string{"_INBOX.>", "events.*"})
+	vr = CreateValidationResults()
+	p.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+	AssertTrue(permits(p.Pub, "req.a.b"), t)
+	AssertFalse(permits(p.Pub, "other"), t)
+	AssertTrue(permits(p.Sub, "_INBOX.x"), t)
+	AssertTrue(permits(p.Sub, "events.a"), t)
+	AssertFalse(permits(p.Sub, "events.a.b"), t)
+	AssertFalse(permits(p.Sub, "req.a"), t)
+
+	p = AllowOnly([]string{"req.>"}, nil)
+	AssertTrue(permits(p.Pub, "req.a"), t)
+	AssertFalse(permits(p.Sub, "req.a"), t)
+	AssertEquals(0, len(p.Pub.Deny), t)
+}
+
+func TestResponsePermissionWithoutSubAllow(t *testing.T) {
+	p := Permissions{Resp: &ResponsePermission{MaxMsgs: 1}}
+	vr := CreateValidationResults()
+	p.Validate(vr)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertFalse(vr.IsBlocking(true), t)
+
+	p.Sub.Allow.Add("svc.>")
+	vr = CreateValidationResults()
+	p.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
+func TestEffectivePermissions(t *testing.T) {
+	p := Permissions{}
+	p.Pub.Allow.Add("foo.bar", "foo.>", "baz", "a.*", "a.b", "foo.>", "z.*.c", "z.b.*")
+	p.Pub.Deny.Add("baz", "x.y", "x.*")
+	p.Sub.Allow.Add("b", "a")
+
+	allowed, denied := p.EffectivePublish()
+	AssertEquals("a.*,foo.>,z.*.c,z.b.*", strings.Join(allowed, ","), t)
+	AssertEquals("baz,x.*", strings.Join(denied, ","), t)
+
+	allowed, denied = p.EffectiveSubscribe()
+	AssertEquals("a,b", strings.Join(allowed, ","), t)
+	AssertEquals(0, len(denied), t)
+
+	// the permission itself is not modified
+	AssertEquals(7, len(p.Pub.Allow), t)
+}
+
+func TestPermissionsCompact(t *testing.T) {
+	p := Permissions{}
+	p.Pub.Allow.Add("foo.bar", "foo.>", "baz", "a.*", "a.b", "a.b.c")
+	p.Pub.Deny.Add("foo.bar.baz", "foo.bar.*", "x")
+	// the only allowed subject is also denied, it has to stay in the allow list
+	p.Sub.Allow.Add("q.r")
+	p.Sub.Deny.Add("q.>")
+	orig := Permissions{}
+	orig.Pub.Allow.Add(p.Pub.Allow...)
+	orig.Pub.Deny.Add(p.Pub.Deny...)
+	orig.Sub.Allow.Add(p.Sub.Allow...)
+	orig.Sub.Deny.Add(p.Sub.Deny...)
+
+	p.Compact()
+	AssertEquals("a.*,a.b.c,baz,foo.>", strings.Join(p.Pub.Allow, ","), t)
+	AssertEquals("foo.bar.*,x", strings.Join(p.Pub.Deny, ","), t)
+	AssertEquals("q.r", strings.Join(p.Sub.Allow, ","), t)
+
+	for _, s := range []string{"foo", "foo.bar", "foo.bar.baz", "foo.bar.baz.x", "foo.x", "baz", "a.b", "a.b.c",
+		"a.c", "a.b.d", "x", "y", "q.r", "q"} {
+		AssertEquals(permits(orig.Pub, s), permits(p.Pub, s), t)
+		AssertEquals(permits(orig.Sub, s), permits(p.Sub, s), t)
+	}
+
+	// empty lists stay empty
+	p = Permissions{}
+	p.Compact()
+	AssertTrue(p.Pub.Allow == nil && p.Sub.Deny == nil, t)
+}
+
+func TestMinimalAllow(t *testing.T) {
+	subjects := []string{"orders.eu.new", "orders.eu.paid", "orders.eu.shipped", "orders.us.new",
+		"metrics", "orders.eu.new", "audit.>", "audit.login"}
+	allow := MinimalAllow(subjects)
+	AssertEquals("audit.>,metrics,orders.eu.*,orders.us.new", strings.Join(allow, ","), t)
+
+	// every input subject stays allowed
+	p := Permission{Allow: allow}
+	for _, s := range subjects {
+		AssertTrue(permits(p, s), t)
+	}
+	// no other prefixes or token counts are granted
+	for _, s := range []string{"orders.us.paid", "orders.eu", "orders.eu.new.x", "metrics.x"} {
+		AssertFalse(permits(p, s), t)
+	}
+
+	// small groups are kept as is
+	AssertEquals("a.b,a.c", strings.Join(MinimalAllow([]string{"a.c", "a.b"}), ","), t)
+	AssertEquals(0, len(MinimalAllow(nil)), t)
+}
+
+func TestMakeSubscriberOnly(t *testing.T) {
+	p := Permissions{Resp: &ResponsePermission{MaxMsgs: 1}}
+	p.Pub.Allow.Add("orders.>", "_INBOX.>", "metrics")
+	p.Sub.Allow.Add("orders.>")
+	vr := p.MakeSubscriberOnly()
+	AssertTrue(vr.IsEmpty(), t)
+
+	AssertTrue(p.Resp == nil, t)
+	AssertEquals("_INBOX.>", strings.Join(p.Pub.Allow, ","), t)
+	AssertEquals(0, len(p.Pub.Deny), t)
+	AssertEquals("orders.>", strings.Join(p.Sub.Allow, ","), t)
+	AssertFalse(permits(p.Pub, "orders.new"), t)
+	AssertTrue(permits(p.Pub, "_INBOX.abc"), t)
+
+	// without inbox nothing can be published
+	p = Permissions{}
+	p.Pub.Allow.Add("orders.>")
+	p.MakeSubscriberOnly()
+	AssertEquals(0, len(p.Pub.Allow), t)
+	AssertEquals(">", strings.Join(p.Pub.Deny, ","), t)
+	AssertFalse(permits(p.Pub, "orders.new"), t)
+
+	vr = CreateValidationResults()
+	p.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	// denies set by the caller are kept
+	p = Permissions{}
+	p.Pub.Allow.Add("_INBOX.>")
+	p.Pub.Deny.Add(">")
+	vr = p.MakeSubscriberOnly()
+	AssertEquals(">", strings.Join(p.Pub.Deny, ","), t)
+	AssertFalse(permits(p.Pub, "_INBOX.abc"), t)
+	AssertEquals(1, len(vr.Warnings()), t)
+	AssertFalse(vr.IsBlocking(true), t)
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		match   bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"foo", "foo.bar", false},
+		{"foo.bar", "foo", false},
+		{"*", "foo", true},
+		{"*", "foo.bar", false},
+		{">", "foo", true},
+		{">", "foo.bar.baz", true},
+		{"foo.*", "foo.bar", true},
+		{"foo.*", "foo", false},
+		{"foo.*", "foo.bar.baz", false},
+		{"foo.>", "foo", false},
+		{"foo.>", "foo.bar", true},
+		{"foo.>", "foo.bar.baz", true},
+		{"foo.>", "bar.baz", false},
+		{"*.bar", "foo.bar", true},
+		{"*.bar", "foo.baz", false},
+		{"foo.*.baz", "foo.bar.baz", true},
+		{"foo.*.baz", "foo.bar.bar", false},
+		{"foo.*.>", "foo.bar.baz.x", true},
+		{"foo.*.>", "foo.bar", false},
+		{"*.*", "foo.bar", true},
+		{"foo.bar", "foo.bar.", false},
+		{"foo.>", "foo.", false},
+		// wildcard subjects are matched by patterns covering everything they match
+		{"foo.*", "foo.*", true},
+		{"foo.>", "foo.*", true},
+		{"foo.>", "foo.>", true},
+		{"foo.>", "foo.*.>", true},
+		{"foo.*", "foo.>", false},
+		{"foo.bar", "foo.*", false},
+		{">", ">", true},
+		{"*", ">", false},
+	}
+	for _, test := range tests {
+		if got := SubjectMatches(test.pattern, test.subject); got != test.match {
+			t.Errorf("SubjectMatches(%q, %q) = %v, expected %v", test.pattern, test.subject, got, test.match)
+		}
+		AssertEquals(test.match, Subject(test.subject).IsContainedIn(Subject(test.pattern)), t)
+	}
+}
+
+func TestPermissionsPolicyText(t *testing.T) {
+	p := Permissions{Resp: &ResponsePermission{MaxMsgs: 1, Expires: 5 * time.Second}}
+	p.Pub.Allow.Add("orders.>", "_INBOX.>")
+	p.Pub.Deny.Add("orders.internal.>")
+	p.Sub.Deny.Add("$SYS.>")
+
+	AssertEquals("May publish to: orders.>, _INBOX.> except orders.internal.>; "+
+		"May subscribe to: any subject except $SYS.>; "+
+		"Responses limited to 1 msgs for 5s", p.PolicyText(), t)
+
+	p = Permissions{}
+	AssertEquals("May publish to: any subject; May subscribe to: any subject", p.PolicyText(), t)
+}
+
+func TestParseSubPermission(t *testing.T) {
+	subj, queue, err := ParseSubPermission("foo.* q1")
+	AssertNoError(err, t)
+	AssertEquals("foo.*", subj, t)
+	AssertEquals("q1", queue, t)
+
+	subj, queue, err = ParseSubPermission("foo.>")
+	AssertNoError(err, t)
+	AssertEquals("foo.>", subj, t)
+	AssertEquals("", queue, t)
+
+	for _, s := range []string{"", " q1", "foo. q1", "foo..bar", "foo ", "foo  q1", "foo q1 q2", "foo q1."} {
+		if _, _, err := ParseSubPermission(s); err == nil {
+			t.Fatalf("expected %q to be malformed", s)
+		}
+	}
+}
+
+func TestPermissionsValidateSubQueues(t *testing.T) {
+	p := Permissions{}
+	p.Sub.Allow.Add("foo.* q1", "bar")
+	p.Sub.Deny.Add("baz q2")
+	vr := CreateValidationResults()
+	p.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	p.Sub.Deny.Add("baz q2 q3", "foo. q1")
+	vr = CreateValidationResults()
+	p.Validate(vr)
+	AssertEquals(2, len(vr.Errors()), t)
+}
+
+func TestSubjectCaptures(t *testing.T) {
+	c := Subject("foo.$2.bar.$1.$x.$").captures()
+	AssertEquals(2, len(c), t)
+	AssertEquals(1, c[0].pos, t)
+	AssertEquals(2, c[0].n, t)
+	AssertEquals("$1", c[1].token, t)
+	AssertEquals(0, len(Subject("foo.*").captures()), t)
+
+	AssertEquals(2, Subject("*.foo.*.>").singleWildcards(), t)
+	AssertEquals(0, Subject("foo.>").singleWildcards(), t)
+}
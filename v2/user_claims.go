@@ -17,7 +17,10 @@ package jwt
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/nats-io/nkeys"
 )
@@ -29,6 +32,14 @@ const (
 	ConnectionTypeMqtt      = "MQTT"
 )
 
+func isKnownConnectionType(ct string) bool {
+	switch strings.ToUpper(ct) {
+	case ConnectionTypeStandard, ConnectionTypeWebsocket, ConnectionTypeLeafnode, ConnectionTypeMqtt:
+		return true
+	}
+	return false
+}
+
 type UserPermissionLimits struct {
 	Permissions
 	Limits
@@ -104,22 +115,83 @@ func DecodeUserClaims(token string) (*UserClaims, error) {
 	}
 	ac, ok := claims.(*UserClaims)
 	if !ok {
-		return nil, errors.New("not user claim")
+		return nil, newUnexpectedClaimTypeError(UserClaim, claims)
 	}
 	return ac, nil
 }
 
+// CanConnect checks if the user can connect with the connection type at the given time.
+// It combines the expiration, the allowed connection types and the time ranges of the
+// user. When the connection is denied, the reason is returned.
+func (u *UserClaims) CanConnect(connType string, now time.Time) (bool, string) {
+	if u.Expires > 0 && now.Unix() > u.Expires {
+		return false, "user is expired"
+	}
+	if u.NotBefore > 0 && now.Unix() < u.NotBefore {
+		return false, "user is not yet valid"
+	}
+	if len(u.AllowedConnectionTypes) > 0 {
+		allowed := false
+		for _, ct := range u.AllowedConnectionTypes {
+			if strings.EqualFold(ct, connType) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, fmt.Sprintf("connection type %q is not allowed", connType)
+		}
+	}
+	if len(u.Times) > 0 {
+		if u.Locale != "" {
+			loc, err := time.LoadLocation(u.Locale)
+			if err != nil {
+				return false, fmt.Sprintf("could not load time zone %q: %v", u.Locale, err)
+			}
+			now = now.In(loc)
+		}
+		inRange := false
+		for _, tr := range u.Times {
+			if tr.contains(now) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false, fmt.Sprintf("connecting at %s is outside the allowed time ranges", now.Format("15:04:05"))
+		}
+	}
+	return true, ""
+}
+
 func (u *UserClaims) ClaimType() ClaimType {
 	return u.Type
 }
 
 // Validate checks the generic and specific parts of the user jwt
 func (u *UserClaims) Validate(vr *ValidationResults) {
-	u.ClaimsData.Validate(vr)
+	u.validate(vr, ValidateOptions{})
+}
+
+func (u *UserClaims) validate(vr *ValidationResults, opts ValidateOptions) {
+	u.ClaimsData.validate(vr, opts.MaxExpiration)
 	u.User.Validate(vr)
 	if u.IssuerAccount != "" && !nkeys.IsValidPublicAccountKey(u.IssuerAccount) {
 		vr.AddError("account_id is not an account public key")
 	}
+	// issuer_account is only set by signing keys, the server looks up the issuer in
+	// the signing keys of the account, which don't include the account itself
+	if u.IssuerAccount != "" && u.IssuerAccount == u.Issuer {
+		vr.AddError("issuer_account %q is the issuer, it must only be set when signed by a signing key", u.IssuerAccount)
+	}
+}
+
+// ValidateWithOptions validates the user claims like Validate, with the strictness
+// configured by the options
+func (u *UserClaims) ValidateWithOptions(vr *ValidationResults, opts ValidateOptions) {
+	from := len(vr.Issues)
+	u.validate(vr, opts)
+	opts.applyTo(vr, from)
 }
 
 // ExpectedPrefixes defines the types that can encode a user JWT, account
@@ -137,6 +209,26 @@ func (u *UserClaims) Payload() interface{} {
 	return &u.User
 }
 
+// Redacted returns a summary of the user claims that is safe to log. It includes a
+// truncated subject, the account, the expiration and the number of permission rules,
+// but none of the permitted subjects.
+func (u *UserClaims) Redacted() string {
+	sub := u.Subject
+	if len(sub) > 8 {
+		sub = sub[:8] + "..."
+	}
+	account := u.IssuerAccount
+	if account == "" {
+		account = u.Issuer
+	}
+	expires := "never"
+	if u.Expires > 0 {
+		expires = time.Unix(u.Expires, 0).UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("user %s account %s expires %s pub %d allow %d deny sub %d allow %d deny",
+		sub, account, expires, len(u.Pub.Allow), len(u.Pub.Deny), len(u.Sub.Allow), len(u.Sub.Deny))
+}
+
 func (u *UserClaims) String() string {
 	return u.ClaimsData.String(u)
 }
@@ -149,3 +241,16 @@ func (u *UserClaims) updateVersion() {
 func (u *UserClaims) IsBearerToken() bool {
 	return u.BearerToken
 }
+
+// BelongsTo returns true if the user was issued by the account with the public key
+// accountPub. Users issued by a signing key can only be confirmed when the account
+// claims are provided, as the signing key has to be one of the account's.
+func (u *UserClaims) BelongsTo(accountPub string, account *AccountClaims) bool {
+	if accountPub == "" || (account != nil && account.Subject != accountPub) {
+		return false
+	}
+	if u.IssuerAccount == "" || u.IssuerAccount == u.Issuer {
+		return u.Issuer == accountPub
+	}
+	return u.IssuerAccount == accountPub && account != nil && account.SigningKeys.Contains(u.Issuer)
+}
@@ -16,7 +16,9 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -282,6 +284,35 @@ func TestUserAccountIDValidation(t *testing.T) {
 	}
 }
 
+func TestUserIssuerAccountRedundant(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	skp := createAccountNKey(t)
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+
+	// signed by the account directly
+	direct, err := DecodeUserClaims(encode(uc, akp, t))
+	AssertNoError(err, t)
+	vr := CreateValidationResults()
+	direct.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+
+	direct.IssuerAccount = apk
+	vr = CreateValidationResults()
+	direct.Validate(vr)
+	if !vr.IsBlocking(false) {
+		t.Fatal("issuer account equal to the issuer should be blocking")
+	}
+
+	// signed by a signing key on behalf of the account
+	uc.IssuerAccount = apk
+	scoped, err := DecodeUserClaims(encode(uc, skp, t))
+	AssertNoError(err, t)
+	vr = CreateValidationResults()
+	scoped.Validate(vr)
+	AssertTrue(vr.IsEmpty(), t)
+}
+
 func TestSourceNetworkValidation(t *testing.T) {
 	ukp := createUserNKey(t)
 	uc := NewUserClaims(publicKey(ukp, t))
@@ -398,3 +429,136 @@ func TestUserClaimRevocation(t *testing.T) {
 		t.Fatal("account validation shouldn't have failed")
 	}
 }
+
+func TestDecodeUnexpectedClaimType(t *testing.T) {
+	akp := createAccountNKey(t)
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+	token := encode(uc, akp, t)
+
+	ac, err := DecodeAccountClaims(token)
+	if ac != nil || err == nil {
+		t.Fatal("user token should not decode as account")
+	}
+	var cte *UnexpectedClaimTypeError
+	if !errors.As(err, &cte) {
+		t.Fatalf("expected a claim type error: %v", err)
+	}
+	AssertEquals(ClaimType(AccountClaim), cte.Expected, t)
+	AssertEquals(ClaimType(UserClaim), cte.Actual, t)
+
+	_, err = DecodeOperatorClaims(token)
+	AssertTrue(errors.As(err, &cte), t)
+	_, err = DecodeActivationClaims(token)
+	AssertTrue(errors.As(err, &cte), t)
+	_, err = DecodeUserClaims(encode(NewAccountClaims(publicKey(akp, t)), akp, t))
+	AssertTrue(errors.As(err, &cte), t)
+	AssertEquals(ClaimType(AccountClaim), cte.Actual, t)
+}
+
+func TestUserBelongsTo(t *testing.T) {
+	akp := createAccountNKey(t)
+	apk := publicKey(akp, t)
+	skp := createAccountNKey(t)
+	account := NewAccountClaims(apk)
+	account.SigningKeys.Add(publicKey(skp, t))
+	other := NewAccountClaims(publicKey(createAccountNKey(t), t))
+
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+	direct, err := DecodeUserClaims(encode(uc, akp, t))
+	AssertNoError(err, t)
+	AssertTrue(direct.BelongsTo(apk, nil), t)
+	AssertTrue(direct.BelongsTo(apk, account), t)
+	AssertFalse(direct.BelongsTo(other.Subject, other), t)
+	AssertFalse(direct.BelongsTo(apk, other), t)
+
+	uc.IssuerAccount = apk
+	scoped, err := DecodeUserClaims(encode(uc, skp, t))
+	AssertNoError(err, t)
+	AssertTrue(scoped.BelongsTo(apk, account), t)
+	// without the account the signing key can't be verified
+	AssertFalse(scoped.BelongsTo(apk, nil), t)
+	AssertFalse(scoped.BelongsTo(other.Subject, other), t)
+
+	// signing key not known to the account
+	uc.IssuerAccount = apk
+	rogue, err := DecodeUserClaims(encode(uc, createAccountNKey(t), t))
+	AssertNoError(err, t)
+	AssertFalse(rogue.BelongsTo(apk, account), t)
+}
+
+func TestUserRedacted(t *testing.T) {
+	akp := createAccountNKey(t)
+	upk := publicKey(createUserNKey(t), t)
+	uc := NewUserClaims(upk)
+	uc.Pub.Allow.Add("secret.orders.>", "secret.billing")
+	uc.Pub.Deny.Add("secret.admin")
+	uc.Sub.Allow.Add("_INBOX.private")
+	uc.Expires = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC).Unix()
+	uc, err := DecodeUserClaims(encode(uc, akp, t))
+	AssertNoError(err, t)
+
+	r := uc.Redacted()
+	for _, s := range []string{"secret", "_INBOX", upk} {
+		AssertFalse(strings.Contains(r, s), t)
+	}
+	AssertTrue(strings.Contains(r, upk[:8]), t)
+	AssertTrue(strings.Contains(r, publicKey(akp, t)), t)
+	AssertTrue(strings.Contains(r, "2030-01-02T03:04:05Z"), t)
+	AssertTrue(strings.Contains(r, "pub 2 allow 1 deny sub 1 allow 0 deny"), t)
+}
+
+func TestUserValidateWithOptions(t *testing.T) {
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+	uc.Resp = &ResponsePermission{MaxMsgs: 1}
+	vr := CreateValidationResults()
+	uc.ValidateWithOptions(vr, ValidateOptions{})
+	AssertEquals(1, len(vr.Warnings()), t)
+	vr = CreateValidationResults()
+	uc.ValidateWithOptions(vr, ValidateOptions{TreatWarningsAsErrors: true})
+	AssertTrue(vr.IsBlocking(false), t)
+
+	uc.Resp = nil
+	uc.NotBefore = time.Now().Add(time.Hour).Unix()
+	vr = CreateValidationResults()
+	uc.ValidateWithOptions(vr, ValidateOptions{EnforceTime: true})
+	AssertTrue(vr.IsBlocking(false), t)
+}
+
+func TestUserCanConnect(t *testing.T) {
+	uc := NewUserClaims(publicKey(createUserNKey(t), t))
+	at := func(clock string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04:05", "2020-06-01 "+clock)
+		AssertNoError(err, t)
+		return tm
+	}
+
+	ok, reason := uc.CanConnect(ConnectionTypeWebsocket, at("12:00:00"))
+	AssertTrue(ok, t)
+	AssertEquals("", reason, t)
+
+	uc.AllowedConnectionTypes.Add(ConnectionTypeStandard)
+	ok, reason = uc.CanConnect(ConnectionTypeWebsocket, at("12:00:00"))
+	AssertFalse(ok, t)
+	AssertTrue(strings.Contains(reason, ConnectionTypeWebsocket), t)
+	ok, _ = uc.CanConnect("standard", at("12:00:00"))
+	AssertTrue(ok, t)
+
+	uc.Times = []TimeRange{{Start: "09:00:00", End: "17:00:00"}}
+	ok, _ = uc.CanConnect(ConnectionTypeStandard, at("12:00:00"))
+	AssertTrue(ok, t)
+	ok, reason = uc.CanConnect(ConnectionTypeStandard, at("18:30:00"))
+	AssertFalse(ok, t)
+	AssertTrue(strings.Contains(reason, "time ranges"), t)
+
+	uc.Times = []TimeRange{{Start: "22:00:00", End: "06:00:00"}}
+	ok, _ = uc.CanConnect(ConnectionTypeStandard, at("23:00:00"))
+	AssertTrue(ok, t)
+	ok, _ = uc.CanConnect(ConnectionTypeStandard, at("12:00:00"))
+	AssertFalse(ok, t)
+
+	uc.Times = nil
+	uc.Expires = at("12:00:00").Unix()
+	ok, reason = uc.CanConnect(ConnectionTypeStandard, at("13:00:00"))
+	AssertFalse(ok, t)
+	AssertEquals("user is expired", reason, t)
+}
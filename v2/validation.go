@@ -18,6 +18,7 @@ package jwt
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // ValidationIssue represents an issue during JWT validation, it may or may not be a blocking error
@@ -116,3 +117,35 @@ func (v *ValidationResults) Warnings() []string {
 	}
 	return errs
 }
+
+// ValidateOptions configures the strictness of ValidateWithOptions. The zero value
+// validates exactly like Validate.
+type ValidateOptions struct {
+	// TreatWarningsAsErrors makes all warnings blocking
+	TreatWarningsAsErrors bool
+	// EnforceTime makes expiration and not before checks blocking
+	EnforceTime bool
+	// RequireHTTPSImports rejects activation tokens of imports retrieved without https
+	RequireHTTPSImports bool
+	// WarnPrivateTokenHosts warns about activation token URLs of imports pointing to loopback,
+	// private or link-local hosts, the server likely can't resolve them
+	WarnPrivateTokenHosts bool
+	// RequireActivationTokens rejects imports without an activation token
+	RequireActivationTokens bool
+	// AllowSelfSigned accepts account claims issued by the account itself
+	AllowSelfSigned bool
+	// MaxExpiration is how far in the future claims can expire before validation warns
+	// about it. Zero uses the default of 10 years, a negative value disables the warning.
+	MaxExpiration time.Duration
+}
+
+// applyTo makes the issues added to the results since from blocking as configured
+func (o ValidateOptions) applyTo(vr *ValidationResults, from int) {
+	for _, i := range vr.Issues[from:] {
+		if i.TimeCheck {
+			i.Blocking = i.Blocking || o.EnforceTime
+		} else {
+			i.Blocking = i.Blocking || o.TreatWarningsAsErrors
+		}
+	}
+}